@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -9,18 +10,24 @@ import (
 	"strings"
 	"time"
 
-	"github.com/getsentry/sentry-go"
-	sentryecho "github.com/getsentry/sentry-go/echo"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/rs/zerolog"
 	"golang.org/x/time/rate"
 
+	"ftbadge/internal/apikey"
 	"ftbadge/internal/cache"
+	"ftbadge/internal/config"
 	"ftbadge/internal/ftapi"
 	"ftbadge/internal/ftvalidator"
 	"ftbadge/internal/handlers"
-	"ftbadge/internal/utils"
+	"ftbadge/internal/metrics"
+	"ftbadge/internal/privacy"
+	"ftbadge/internal/ratelimit"
+	"ftbadge/internal/reporting"
+	"ftbadge/internal/state"
+	"ftbadge/internal/tracing"
+	"ftbadge/internal/warmup"
 )
 
 func rateLimiterIdentifierExtractor(ctx echo.Context) (string, error) {
@@ -34,39 +41,85 @@ func rateLimiterErrorHandler(ctx echo.Context, err error) error {
 }
 
 func rateLimiterDenyHandler(ctx echo.Context, identifier string, err error) error {
+	metrics.RecordRateLimitRejection(ctx)
 	data := map[string]string{"error": "rate limit exceeded"}
 	return ctx.JSON(http.StatusTooManyRequests, data)
 }
 
+func newWarmupScheduler(cfg config.WarmupConfig, ftc *ftapi.Client, cc cache.CacheClient, store state.Store, tracker *warmup.Tracker, serviceState *handlers.ServiceState, registry *privacy.Registry, logger zerolog.Logger) *warmup.Scheduler {
+	ttl, _ := cache.DefaultTTL(cache.CacheKeyProfile)
+
+	skip := func(ctx context.Context, login string) (bool, error) {
+		if serviceState.Maintenance() || serviceState.Blocked(login) {
+			return true, nil
+		}
+		return registry.OptedOut(ctx, login)
+	}
+
+	schedulerConfig := warmup.SchedulerConfig{
+		Logins:    cfg.Logins,
+		StatsPath: cfg.StatsPath,
+		TopN:      cfg.TopN,
+		Interval:  cfg.Interval,
+		Margin:    cfg.Margin,
+		TTL:       ttl,
+		Rate:      rate.Every(cfg.RequestInterval),
+		Warm: func(ctx context.Context, login string) (time.Time, error) {
+			if skipped, err := skip(ctx, login); err != nil || skipped {
+				return time.Time{}, err
+			}
+			return handlers.WarmProfile(ctx, ftc, cc, store, login)
+		},
+		Refresh: func(ctx context.Context, login string) (time.Time, error) {
+			if skipped, err := skip(ctx, login); err != nil || skipped {
+				return time.Time{}, err
+			}
+			return handlers.RefreshProfile(ctx, ftc, cc, store, login)
+		},
+		Logger: logger,
+	}
+	return warmup.NewScheduler(schedulerConfig, tracker)
+}
+
 func main() {
-	port := utils.GetEnvWithDefault("PORT", "3000")
-	sentryDSN := utils.MustGetEnv("SENTRY_DSN")
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatalf("failed to load configuration: %v", err)
+	}
 
-	sentryConfig := sentry.ClientOptions{
-		Dsn: sentryDSN,
+	logger := zerolog.New(os.Stdout)
+
+	reporter, err := reporting.New(cfg.Reporting, logger)
+	if err != nil {
+		log.Fatalf("error reporting initialization failed: %v", err)
 	}
-	if err := sentry.Init(sentryConfig); err != nil {
-		log.Fatalf("sentry initialization failed: %v", err)
+	defer reporter.Flush(2 * time.Second)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatalf("tracing initialization failed: %v", err)
 	}
+	defer shutdownTracing(context.Background())
 
-	localClient, err := cache.NewLocalClient()
+	cacheClient, err := cache.NewClient(cfg.Cache, logger)
 	if err != nil {
 		log.Fatalf("failed to setup cache client: %v", err)
 	}
+	if closer, ok := cacheClient.(io.Closer); ok {
+		defer closer.Close()
+	}
 
-	ftc := ftapi.NewClient(
-		"https://api.intra.42.fr/v2",
-		"https://cdn.intra.42.fr",
-	)
+	ftc := ftapi.NewClient(cfg.Intra)
 
 	e := echo.New()
 	e.HideBanner = true
 	e.Validator = ftvalidator.New()
+	e.HTTPErrorHandler = handlers.NewHTTPErrorHandler(e, reporter)
 
-	logger := zerolog.New(os.Stdout)
 	requestLoggerConfig := middleware.RequestLoggerConfig{
 		Skipper: func(ctx echo.Context) bool {
-			return ctx.Request().URL.Path == "/health" && ctx.Response().Status == http.StatusOK
+			path := ctx.Request().URL.Path
+			return strings.HasPrefix(path, "/health") && ctx.Response().Status == http.StatusOK
 		},
 		LogRequestID: true,
 		LogMethod:    true,
@@ -79,8 +132,9 @@ func main() {
 			logger.Info().
 				Time("start_time", v.StartTime).
 				Str("request_id", v.RequestID).
+				Str("trace_id", tracing.TraceID(ctx.Request().Context())).
 				Str("method", v.Method).
-				Str("uri", v.URI).
+				Str("uri", reporting.Scrub(v.URI)).
 				Str("user_agent", v.UserAgent).
 				Int("status", v.Status).
 				Err(v.Error).
@@ -90,46 +144,165 @@ func main() {
 			return nil
 		},
 	}
+	globalRateLimiterStore, err := ratelimit.NewStore(cfg.RateLimit, "global", cfg.RateLimit.Global, cacheClient)
+	if err != nil {
+		log.Fatalf("failed to setup global rate limiter: %v", err)
+	}
 	globalRateLimiterConfig := middleware.RateLimiterConfig{
 		Skipper: func(c echo.Context) bool {
-			return c.Request().URL.Path == "/health" || strings.HasPrefix(c.Request().URL.Path, "/profile")
+			path := c.Request().URL.Path
+			// Readiness checks reach the cache and the Intra API, so they are limited
+			return path == "/health" || path == "/health/live" || strings.HasPrefix(path, "/profile")
 		},
-		Store: middleware.NewRateLimiterMemoryStoreWithConfig(
-			middleware.RateLimiterMemoryStoreConfig{Rate: rate.Limit(20), Burst: 30, ExpiresIn: 3 * time.Minute},
-		),
+		Store:               globalRateLimiterStore,
 		IdentifierExtractor: rateLimiterIdentifierExtractor,
 		ErrorHandler:        rateLimiterErrorHandler,
 		DenyHandler:         rateLimiterDenyHandler,
 	}
-	sentryEchoConfig := sentryecho.Options{
-		Repanic: true,
-	}
 
 	e.Use(middleware.RequestID())
+	e.Use(tracing.Middleware())
+	e.Use(metrics.Middleware())
 	e.Use(middleware.RequestLoggerWithConfig(requestLoggerConfig))
 	e.Use(middleware.RateLimiterWithConfig(globalRateLimiterConfig))
+	e.Use(handlers.ReportingScope(reporter))
 	e.Use(middleware.Recover())
-	e.Use(sentryecho.New(sentryEchoConfig))
 	e.Use(middleware.Gzip())
 
-	profileRateLimiterConfig := middleware.RateLimiterConfig{
-		Skipper: middleware.DefaultSkipper,
-		Store: middleware.NewRateLimiterMemoryStoreWithConfig(
-			middleware.RateLimiterMemoryStoreConfig{Rate: rate.Limit(1), Burst: 5, ExpiresIn: 3 * time.Minute},
-		),
-		IdentifierExtractor: rateLimiterIdentifierExtractor,
-		ErrorHandler:        rateLimiterErrorHandler,
-		DenyHandler:         rateLimiterDenyHandler,
+	profileRateLimiterStore, err := ratelimit.NewStore(cfg.RateLimit, "profile", cfg.RateLimit.Profile, cacheClient)
+	if err != nil {
+		log.Fatalf("failed to setup profile rate limiter: %v", err)
+	}
+	loginRateLimiterStore, err := ratelimit.NewDistinctStoreFromConfig(cfg.RateLimit, "login", cfg.RateLimit.Login, cacheClient)
+	if err != nil {
+		log.Fatalf("failed to setup login rate limiter: %v", err)
 	}
 
+	stateStore, err := state.NewStore(cfg.State, cacheClient)
+	if err != nil {
+		log.Fatalf("failed to setup state store: %v", err)
+	}
+	if closer, ok := stateStore.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	var apiKeys *apikey.Manager
+	if cfg.APIKeys.Enabled {
+		apiKeys = apikey.NewManager(apikey.NewStore(stateStore), cfg.APIKeys, func(name string, limiter config.LimiterConfig) (middleware.RateLimiterStore, error) {
+			return ratelimit.NewStore(cfg.RateLimit, name, limiter, cacheClient)
+		})
+	}
+
+	serviceState, err := handlers.NewServiceState(context.Background(), stateStore, cfg.Admin.Blocklist)
+	if err != nil {
+		log.Fatalf("failed to load service state: %v", err)
+	}
+	privacyRegistry := privacy.NewRegistry(stateStore)
+	tracker := warmup.NewTracker(cfg.Warmup.TopN * warmup.TrackedLoginsPerTopLogin)
+	scheduler := newWarmupScheduler(cfg.Warmup, ftc, cacheClient, stateStore, tracker, serviceState, privacyRegistry, logger)
+
 	e.GET("/health", handlers.HealthCheckHandler)
-	e.GET("/profile/:login", handlers.GetProfileHandler(ftc, localClient), middleware.RateLimiterWithConfig(profileRateLimiterConfig))
+	e.GET("/health/live", handlers.HealthCheckHandler)
+	e.GET("/health/ready", handlers.GetReadinessHandler(
+		handlers.CacheHealthCheck(cacheClient),
+		handlers.IntraHealthCheck(ftc, cacheClient),
+		handlers.TemplateHealthCheck(),
+	))
+	profileMiddlewares := []echo.MiddlewareFunc{}
+	if apiKeys != nil {
+		profileMiddlewares = append(profileMiddlewares, handlers.APIKeyMiddleware(apiKeys, cfg.APIKeys))
+	}
+	e.GET("/profile/:login", handlers.GetProfileHandler(ftc, cacheClient, handlers.ProfileHandlerOptions{
+		Tracker: tracker,
+		Limiters: &handlers.ProfileLimiters{
+			IP:      profileRateLimiterStore,
+			APIKeys: apiKeys,
+			Login:   loginRateLimiterStore,
+		},
+		State:       serviceState,
+		Privacy:     privacyRegistry,
+		Preferences: stateStore,
+	}), profileMiddlewares...)
+
+	if cfg.Auth.RedirectURL != "" {
+		sessions := handlers.NewSessions(cfg.Auth)
+		selfService := &handlers.SelfService{
+			Intra:       ftc,
+			Cache:       cacheClient,
+			Privacy:     privacyRegistry,
+			State:       stateStore,
+			Sessions:    sessions,
+			RedirectURL: cfg.Auth.RedirectURL,
+		}
+		e.GET("/auth/login", selfService.Login)
+		e.GET("/auth/callback", selfService.Callback)
+		e.POST("/auth/logout", selfService.Logout)
+
+		me := e.Group("/me", sessions.RequireSession())
+		me.GET("", selfService.Me)
+		me.PUT("/preferences", selfService.SetPreferences)
+		me.PUT("/opt-out", selfService.SetOptOut)
+	}
+
+	if cfg.Admin.Token != "" {
+		admin := e.Group("/admin", handlers.AdminAuditLog(logger), handlers.AdminAuth(cfg.Admin.Token))
+		admin.DELETE("/cache/:login", handlers.GetPurgeCacheHandler(cacheClient))
+		admin.GET("/cache/stats", handlers.GetCacheStatsHandler(cacheClient))
+		admin.GET("/intra/quota", handlers.GetIntraQuotaHandler(ftc))
+		admin.GET("/maintenance", handlers.GetMaintenanceHandler(serviceState))
+		admin.PUT("/maintenance", handlers.GetSetMaintenanceHandler(serviceState))
+		admin.GET("/blocklist", handlers.GetBlocklistHandler(serviceState))
+		admin.PUT("/blocklist/:login", handlers.GetBlockLoginHandler(serviceState, cacheClient))
+		admin.DELETE("/blocklist/:login", handlers.GetUnblockLoginHandler(serviceState))
+		admin.GET("/optouts", handlers.GetOptOutsHandler(privacyRegistry))
+		admin.PUT("/optouts/:login", handlers.GetOptOutHandler(privacyRegistry, cacheClient))
+		admin.DELETE("/optouts/:login", handlers.GetOptInHandler(privacyRegistry))
+		if apiKeys != nil {
+			admin.POST("/keys", handlers.GetIssueAPIKeyHandler(apiKeys))
+			admin.GET("/keys", handlers.GetListAPIKeysHandler(apiKeys))
+			admin.GET("/keys/:id", handlers.GetAPIKeyHandler(apiKeys))
+			admin.DELETE("/keys/:id", handlers.GetRevokeAPIKeyHandler(apiKeys))
+		}
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
+	schedulerDone := make(chan struct{})
+	go func(ctx context.Context) {
+		defer close(schedulerDone)
+		scheduler.Run(ctx)
+	}(ctx)
+	defer func() { <-schedulerDone }()
+	go serviceState.Run(ctx, cfg.Admin.RefreshInterval)
+
+	if apiKeys != nil {
+		usageDone := make(chan struct{})
+		go func(ctx context.Context) {
+			defer close(usageDone)
+			apiKeys.Run(ctx, cfg.APIKeys.FlushInterval)
+		}(ctx)
+		defer func() { <-usageDone }()
+	}
+
+	var metricsServer *http.Server
+	if cfg.MetricsPort != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metrics.Handler())
+		metricsServer = &http.Server{
+			Addr:              ":" + cfg.MetricsPort,
+			Handler:           metricsMux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				e.Logger.Fatal(err)
+			}
+		}()
+	}
+
 	go func() {
-		if err := e.Start(":" + port); err != nil && err != http.ErrServerClosed {
+		if err := e.Start(":" + cfg.Port); err != nil && err != http.ErrServerClosed {
 			e.Logger.Fatal(err)
 		}
 	}()
@@ -138,6 +311,11 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			e.Logger.Fatal(err)
+		}
+	}
 	if err := e.Shutdown(ctx); err != nil {
 		e.Logger.Fatal(err)
 	}
@@ -0,0 +1,345 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4/middleware"
+
+	"ftbadge/internal/config"
+)
+
+const (
+	tokenPrefix = "ftb"
+	idSize      = 8
+	secretSize  = 24
+)
+
+const flushTimeout = 5 * time.Second
+
+var (
+	ErrInvalidKey    = errors.New("invalid API key")
+	ErrQuotaExceeded = errors.New("API key daily quota exceeded")
+)
+
+type Key struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	SecretHash string     `json:"secret_hash"`
+	Rate       float64    `json:"rate"`
+	Burst      int        `json:"burst"`
+	DailyQuota int64      `json:"daily_quota"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (k *Key) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+type Usage struct {
+	Today int64 `json:"today"`
+	Total int64 `json:"total"`
+}
+
+type LimiterFactory func(name string, cfg config.LimiterConfig) (middleware.RateLimiterStore, error)
+
+type usageKey struct {
+	id  string
+	day string
+}
+
+type Manager struct {
+	store      *Store
+	newLimiter LimiterFactory
+	defaults   config.APIKeyConfig
+	now        func() time.Time
+
+	mu       sync.Mutex
+	limiters map[string]middleware.RateLimiterStore
+
+	// Usage is counted in memory and written to the store by Flush. today
+	// holds the count of the day read from the store plus pending requests.
+	usageMu sync.Mutex
+	today   map[usageKey]int64
+	pending map[usageKey]int64
+}
+
+func NewManager(store *Store, cfg config.APIKeyConfig, newLimiter LimiterFactory) *Manager {
+	return &Manager{
+		store:      store,
+		newLimiter: newLimiter,
+		defaults:   cfg,
+		now:        time.Now,
+		limiters:   make(map[string]middleware.RateLimiterStore),
+		today:      make(map[usageKey]int64),
+		pending:    make(map[usageKey]int64),
+	}
+}
+
+type IssueOptions struct {
+	Name  string
+	Rate  float64
+	Burst int
+	// Defaults to the configured quota when nil, zero is unlimited
+	DailyQuota *int64
+}
+
+func hashSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+func randomHex(size int) (string, error) {
+	buffer := make([]byte, size)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
+
+func (m *Manager) day() string {
+	return m.now().UTC().Format(time.DateOnly)
+}
+
+// Issue creates a key and returns the token given to the integrator. Only a
+// hash of the secret part is stored, so the token cannot be shown again.
+func (m *Manager) Issue(ctx context.Context, options IssueOptions) (string, *Key, error) {
+	id, err := randomHex(idSize)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate key id: %w", err)
+	}
+	secret, err := randomHex(secretSize)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate key secret: %w", err)
+	}
+
+	key := &Key{
+		ID:         id,
+		Name:       options.Name,
+		SecretHash: hashSecret(secret),
+		Rate:       options.Rate,
+		Burst:      options.Burst,
+		DailyQuota: m.defaults.DailyQuota,
+		CreatedAt:  m.now().UTC(),
+	}
+	if key.Rate <= 0 {
+		key.Rate = m.defaults.Limit.Rate
+	}
+	if key.Burst <= 0 {
+		key.Burst = m.defaults.Limit.Burst
+	}
+	if options.DailyQuota != nil {
+		key.DailyQuota = *options.DailyQuota
+	}
+
+	if err := m.store.Save(ctx, key); err != nil {
+		return "", nil, fmt.Errorf("failed to save key %q: %w", id, err)
+	}
+	return strings.Join([]string{tokenPrefix, id, secret}, "_"), key, nil
+}
+
+// Authenticate returns the active key matching token or ErrInvalidKey.
+func (m *Manager) Authenticate(ctx context.Context, token string) (*Key, error) {
+	parts := strings.Split(token, "_")
+	if len(parts) != 3 || parts[0] != tokenPrefix {
+		return nil, ErrInvalidKey
+	}
+
+	key, err := m.store.Get(ctx, parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key %q: %w", parts[1], err)
+	}
+	if key == nil || key.Revoked() {
+		return nil, ErrInvalidKey
+	}
+	if subtle.ConstantTimeCompare([]byte(key.SecretHash), []byte(hashSecret(parts[2]))) != 1 {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// Record counts a request made with key and returns ErrQuotaExceeded once the
+// daily quota is used up. A zero quota is unlimited. The count of the day is
+// only read from the store on the first request, so requests served by other
+// instances are included after the next flush.
+func (m *Manager) Record(ctx context.Context, key *Key) error {
+	usage := usageKey{key.ID, m.day()}
+
+	m.usageMu.Lock()
+	_, loaded := m.today[usage]
+	m.usageMu.Unlock()
+	if !loaded {
+		stored, err := m.store.Usage(ctx, key.ID, usage.day)
+		if err != nil {
+			return fmt.Errorf("failed to get usage of key %q: %w", key.ID, err)
+		}
+		m.usageMu.Lock()
+		if _, loaded := m.today[usage]; !loaded {
+			m.today[usage] = stored.Today + m.pending[usage]
+		}
+		m.usageMu.Unlock()
+	}
+
+	m.usageMu.Lock()
+	m.today[usage]++
+	m.pending[usage]++
+	count := m.today[usage]
+	m.usageMu.Unlock()
+
+	if key.DailyQuota > 0 && count > key.DailyQuota {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// Flush writes the usage recorded since the last flush to the store. Usage
+// that failed to be written is kept for the next flush.
+func (m *Manager) Flush(ctx context.Context) error {
+	m.usageMu.Lock()
+	pending := m.pending
+	m.pending = make(map[usageKey]int64)
+	m.usageMu.Unlock()
+
+	days := make(map[string]map[string]int64)
+	for usage, count := range pending {
+		if days[usage.day] == nil {
+			days[usage.day] = make(map[string]int64)
+		}
+		days[usage.day][usage.id] = count
+	}
+
+	var errs []error
+	for day, counts := range days {
+		totals, err := m.store.AddUsage(ctx, day, counts)
+
+		m.usageMu.Lock()
+		if err != nil {
+			for id, count := range counts {
+				m.pending[usageKey{id, day}] += count
+			}
+			errs = append(errs, fmt.Errorf("failed to add usage of %s: %w", day, err))
+		}
+		for id, total := range totals {
+			usage := usageKey{id, day}
+			// Includes the requests served by other instances
+			m.today[usage] = total + m.pending[usage]
+		}
+		m.usageMu.Unlock()
+	}
+
+	today := m.day()
+	m.usageMu.Lock()
+	for usage := range m.today {
+		if usage.day != today {
+			delete(m.today, usage)
+		}
+	}
+	m.usageMu.Unlock()
+
+	return errors.Join(errs...)
+}
+
+// Run flushes usage every interval until ctx is done, then one last time.
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), flushTimeout)
+			defer cancel()
+			_ = m.Flush(flushCtx)
+			return
+		case <-ticker.C:
+			_ = m.Flush(ctx)
+		}
+	}
+}
+
+// Allow charges the rate limit of key, shared with other instances when the
+// rate limiter store is.
+func (m *Manager) Allow(key *Key) (bool, error) {
+	m.mu.Lock()
+	limiter, exists := m.limiters[key.ID]
+	if !exists {
+		var err error
+		limiter, err = m.newLimiter("apikey:"+key.ID, config.LimiterConfig{
+			Rate:      key.Rate,
+			Burst:     key.Burst,
+			ExpiresIn: m.defaults.Limit.ExpiresIn,
+		})
+		if err != nil {
+			m.mu.Unlock()
+			return false, fmt.Errorf("failed to create rate limiter for key %q: %w", key.ID, err)
+		}
+		m.limiters[key.ID] = limiter
+	}
+	m.mu.Unlock()
+
+	return limiter.Allow(key.ID)
+}
+
+// Revoke returns false when the key does not exist.
+func (m *Manager) Revoke(ctx context.Context, id string) (bool, error) {
+	key, err := m.store.Get(ctx, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to get key %q: %w", id, err)
+	}
+	if key == nil {
+		return false, nil
+	}
+	if key.Revoked() {
+		return true, nil
+	}
+
+	revokedAt := m.now().UTC()
+	key.RevokedAt = &revokedAt
+	if err := m.store.Save(ctx, key); err != nil {
+		return false, fmt.Errorf("failed to save key %q: %w", id, err)
+	}
+
+	m.mu.Lock()
+	delete(m.limiters, id)
+	m.mu.Unlock()
+	return true, nil
+}
+
+func (m *Manager) Get(ctx context.Context, id string) (*Key, error) {
+	return m.store.Get(ctx, id)
+}
+
+func (m *Manager) List(ctx context.Context) ([]*Key, error) {
+	return m.store.List(ctx)
+}
+
+// Usage includes the requests of this instance that are not flushed yet.
+func (m *Manager) Usage(ctx context.Context, id string) (Usage, error) {
+	day := m.day()
+	usage, err := m.store.Usage(ctx, id, day)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	m.usageMu.Lock()
+	defer m.usageMu.Unlock()
+	for pendingUsage, count := range m.pending {
+		if pendingUsage.id != id {
+			continue
+		}
+		if pendingUsage.day == day {
+			usage.Today += count
+		}
+		usage.Total += count
+	}
+	return usage, nil
+}
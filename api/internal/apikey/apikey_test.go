@@ -0,0 +1,126 @@
+package apikey
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/time/rate"
+
+	"ftbadge/internal/config"
+	"ftbadge/internal/state"
+)
+
+func memoryLimiter(name string, cfg config.LimiterConfig) (middleware.RateLimiterStore, error) {
+	return middleware.NewRateLimiterMemoryStoreWithConfig(
+		middleware.RateLimiterMemoryStoreConfig{Rate: rate.Limit(cfg.Rate), Burst: cfg.Burst, ExpiresIn: cfg.ExpiresIn},
+	), nil
+}
+
+func TestManager(t *testing.T) {
+	stores := map[string]func(t *testing.T) state.Store{
+		state.StoreBolt: func(t *testing.T) state.Store {
+			store, err := state.NewBoltStore(filepath.Join(t.TempDir(), "state.db"))
+			if err != nil {
+				t.Fatalf("Failed to open bolt store: %v", err)
+			}
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
+		state.StoreRedis: func(t *testing.T) state.Store {
+			server := miniredis.RunT(t)
+			return state.NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			cfg := config.Default().APIKeys
+			store := NewStore(newStore(t))
+			manager := NewManager(store, cfg, memoryLimiter)
+			now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+			manager.now = func() time.Time { return now }
+
+			quota := int64(2)
+			token, key, err := manager.Issue(t.Context(), IssueOptions{Name: "dashboard", Burst: 1, DailyQuota: &quota})
+			if err != nil {
+				t.Fatalf("Failed to issue key: %v", err)
+			}
+			if key.Rate != cfg.Limit.Rate || key.Burst != 1 {
+				t.Fatalf("Unexpected key limits: %+v", key)
+			}
+
+			authenticated, err := manager.Authenticate(t.Context(), token)
+			if err != nil {
+				t.Fatalf("Failed to authenticate key: %v", err)
+			}
+			if authenticated.ID != key.ID {
+				t.Fatalf("Expected key %q, got %q", key.ID, authenticated.ID)
+			}
+			if _, err := manager.Authenticate(t.Context(), token+"0"); !errors.Is(err, ErrInvalidKey) {
+				t.Fatalf("Expected tampered token to be rejected, got %v", err)
+			}
+
+			for range 2 {
+				if err := manager.Record(t.Context(), key); err != nil {
+					t.Fatalf("Failed to record usage: %v", err)
+				}
+			}
+			if err := manager.Record(t.Context(), key); !errors.Is(err, ErrQuotaExceeded) {
+				t.Fatalf("Expected quota to be exceeded, got %v", err)
+			}
+			now = now.Add(24 * time.Hour)
+			if err := manager.Record(t.Context(), key); err != nil {
+				t.Fatalf("Expected quota to reset the next day, got %v", err)
+			}
+			usage, err := manager.Usage(t.Context(), key.ID)
+			if err != nil {
+				t.Fatalf("Failed to get usage: %v", err)
+			}
+			if usage != (Usage{Today: 1, Total: 4}) {
+				t.Fatalf("Unexpected usage: %+v", usage)
+			}
+
+			if err := manager.Flush(t.Context()); err != nil {
+				t.Fatalf("Failed to flush usage: %v", err)
+			}
+			other := NewManager(store, cfg, memoryLimiter)
+			other.now = manager.now
+			if usage, err := other.Usage(t.Context(), key.ID); err != nil || usage != (Usage{Today: 1, Total: 4}) {
+				t.Fatalf("Expected flushed usage to be stored, got %+v, %v", usage, err)
+			}
+			if err := other.Record(t.Context(), key); err != nil {
+				t.Fatalf("Failed to record usage: %v", err)
+			}
+			if err := other.Record(t.Context(), key); !errors.Is(err, ErrQuotaExceeded) {
+				t.Fatalf("Expected the stored usage to count towards the quota, got %v", err)
+			}
+
+			if allowed, err := manager.Allow(key); err != nil || !allowed {
+				t.Fatalf("Expected first request within burst to be allowed, got %v, %v", allowed, err)
+			}
+			if allowed, _ := manager.Allow(key); allowed {
+				t.Fatal("Expected request over the key burst to be denied")
+			}
+
+			revoked, err := manager.Revoke(t.Context(), key.ID)
+			if err != nil || !revoked {
+				t.Fatalf("Failed to revoke key: %v", err)
+			}
+			if _, err := manager.Authenticate(t.Context(), token); !errors.Is(err, ErrInvalidKey) {
+				t.Fatalf("Expected revoked key to be rejected, got %v", err)
+			}
+			keys, err := manager.List(t.Context())
+			if err != nil {
+				t.Fatalf("Failed to list keys: %v", err)
+			}
+			if len(keys) != 1 || !keys[0].Revoked() {
+				t.Fatalf("Expected the revoked key to be listed, got %+v", keys)
+			}
+		})
+	}
+}
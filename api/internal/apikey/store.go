@@ -0,0 +1,112 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"ftbadge/internal/state"
+)
+
+const keySet = "apikeys"
+
+func keyStateKey(id string) string {
+	return "apikey:key:" + id
+}
+
+func usageStateKey(id string, period string) string {
+	return "apikey:usage:" + id + ":" + period
+}
+
+// Store keeps keys and their usage counters in the state store. Daily counters
+// are kept forever, they are only a few bytes per key and day.
+type Store struct {
+	state state.Store
+}
+
+func NewStore(store state.Store) *Store {
+	return &Store{store}
+}
+
+func (s *Store) Save(ctx context.Context, key *Key) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	if err := s.state.Set(ctx, keyStateKey(key.ID), string(data)); err != nil {
+		return err
+	}
+	return s.state.AddMember(ctx, keySet, key.ID)
+}
+
+// Get returns nil when the key does not exist.
+func (s *Store) Get(ctx context.Context, id string) (*Key, error) {
+	data, found, err := s.state.Get(ctx, keyStateKey(id))
+	if err != nil || !found {
+		return nil, err
+	}
+
+	key := &Key{}
+	if err := json.Unmarshal([]byte(data), key); err != nil {
+		return nil, fmt.Errorf("failed to decode key %q: %w", id, err)
+	}
+	return key, nil
+}
+
+func (s *Store) List(ctx context.Context) ([]*Key, error) {
+	ids, err := s.state.Members(ctx, keySet)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*Key, 0, len(ids))
+	for _, id := range ids {
+		key, err := s.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if key != nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// AddUsage adds the requests of the day by key id and returns the new count of
+// the day of each key.
+func (s *Store) AddUsage(ctx context.Context, day string, counts map[string]int64) (map[string]int64, error) {
+	deltas := make(map[string]int64, 2*len(counts))
+	for id, count := range counts {
+		deltas[usageStateKey(id, day)] = count
+		deltas[usageStateKey(id, "total")] = count
+	}
+	values, err := s.state.Increment(ctx, deltas)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]int64, len(counts))
+	for id := range counts {
+		totals[id] = values[usageStateKey(id, day)]
+	}
+	return totals, nil
+}
+
+func (s *Store) Usage(ctx context.Context, id string, day string) (Usage, error) {
+	counters := make([]int64, 2)
+	for index, period := range []string{day, "total"} {
+		key := usageStateKey(id, period)
+		value, found, err := s.state.Get(ctx, key)
+		if err != nil {
+			return Usage{}, err
+		}
+		if !found {
+			continue
+		}
+		if counters[index], err = strconv.ParseInt(value, 10, 64); err != nil {
+			return Usage{}, fmt.Errorf("failed to decode usage counter %q: %w", key, err)
+		}
+	}
+	return Usage{Today: counters[0], Total: counters[1]}, nil
+}
@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Deleter is implemented by clients that can remove entries before they expire.
+type Deleter interface {
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// StatsReporter is implemented by clients that expose backend statistics.
+type StatsReporter interface {
+	Stats(ctx context.Context) (map[string]any, error)
+}
+
+func Stats(ctx context.Context, client CacheClient) (map[string]any, error) {
+	reporter, ok := client.(StatsReporter)
+	if !ok {
+		return map[string]any{}, nil
+	}
+	return reporter.Stats(ctx)
+}
+
+func Delete(ctx context.Context, client CacheClient, keys ...string) error {
+	deleter, ok := client.(Deleter)
+	if !ok {
+		return fmt.Errorf("cache client %T does not support deletion", client)
+	}
+	return deleter.Delete(ctx, keys...)
+}
+
+// Purge removes the given keys of the manager id from the cache.
+func (cm *CacheManager) Purge(ctx context.Context, cacheKeys ...CacheKey) error {
+	keys := make([]string, 0, len(cacheKeys))
+	for _, cacheKey := range cacheKeys {
+		cacheKeyGenerator, exists := cacheKeyGenerators[cacheKey]
+		if !exists {
+			return fmt.Errorf("cache key %d does not have a corresponding generator function", cacheKey)
+		}
+		keys = append(keys, cacheKeyGenerator(cm.id))
+		delete(cm.data, cacheKey)
+	}
+
+	if err := Delete(ctx, cm.client, keys...); err != nil {
+		return fmt.Errorf("failed to delete cache keys %q: %w", keys, err)
+	}
+	return nil
+}
+
+func (rc *RedisClient) Delete(ctx context.Context, keys ...string) error {
+	return rc.client.Del(ctx, keys...).Err()
+}
+
+func (rc *RedisClient) Stats(ctx context.Context) (map[string]any, error) {
+	size, err := rc.client.DBSize(ctx).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Redis database size: %w", err)
+	}
+	info, err := rc.client.Info(ctx, "stats", "memory").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Redis info: %w", err)
+	}
+
+	stats := map[string]any{"backend": "redis", "keys": size}
+	scanner := bufio.NewScanner(strings.NewReader(info))
+	for scanner.Scan() {
+		name, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !found {
+			continue
+		}
+		switch name {
+		case "keyspace_hits", "keyspace_misses", "evicted_keys", "expired_keys", "used_memory":
+			if parsed, err := strconv.ParseInt(value, 10, 64); err == nil {
+				stats[name] = parsed
+			}
+		}
+	}
+	return stats, nil
+}
+
+func (lc *LocalClient) Delete(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		lc.cache.Del(key)
+	}
+	lc.cache.Wait()
+	return nil
+}
+
+func (lc *LocalClient) Stats(ctx context.Context) (map[string]any, error) {
+	metrics := lc.cache.Metrics
+	return map[string]any{
+		"backend":      "local",
+		"hits":         metrics.Hits(),
+		"misses":       metrics.Misses(),
+		"hit_ratio":    metrics.Ratio(),
+		"keys_added":   metrics.KeysAdded(),
+		"keys_evicted": metrics.KeysEvicted(),
+		"cost_added":   metrics.CostAdded(),
+		"cost_evicted": metrics.CostEvicted(),
+	}, nil
+}
+
+func (dc *DiskClient) Delete(ctx context.Context, keys ...string) error {
+	return dc.update(func(tx *bolt.Tx, size int64) (int64, error) {
+		bucket := tx.Bucket(diskBucketName)
+		for _, key := range keys {
+			size -= diskEntrySize([]byte(key), bucket.Get([]byte(key)))
+			if err := bucket.Delete([]byte(key)); err != nil {
+				return 0, err
+			}
+		}
+		return size, nil
+	})
+}
+
+func (dc *DiskClient) Stats(ctx context.Context) (map[string]any, error) {
+	dc.writeMu.Lock()
+	stats := map[string]any{"backend": "disk", "max_size": dc.maxSize, "size": dc.size}
+	dc.writeMu.Unlock()
+	err := dc.view(func(tx *bolt.Tx) error {
+		stats["keys"] = tx.Bucket(diskBucketName).Stats().KeyN
+		stats["file_size"] = tx.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read disk cache stats: %w", err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,213 @@
+// Package cachetest provides an in-memory cache.CacheClient for tests.
+package cachetest
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"ftbadge/internal/cache"
+)
+
+const (
+	MethodGet     = "Get"
+	MethodBulkSet = "BulkSet"
+	MethodBulkGet = "BulkGet"
+	MethodDelete  = "Delete"
+)
+
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+type Call struct {
+	Method  string
+	Keys    []string
+	Entries []cache.CacheEntry
+}
+
+type entry struct {
+	value     string
+	expiresAt time.Time
+}
+
+type Client struct {
+	mu      sync.Mutex
+	clock   *Clock
+	entries map[string]entry
+	calls   []Call
+	faults  map[string]error
+}
+
+var (
+	_ cache.CacheClient = (*Client)(nil)
+	_ cache.Deleter     = (*Client)(nil)
+)
+
+func NewClient(clock *Clock) *Client {
+	if clock == nil {
+		clock = NewClock(time.Now())
+	}
+	return &Client{
+		clock:   clock,
+		entries: make(map[string]entry),
+		faults:  make(map[string]error),
+	}
+}
+
+func (c *Client) Clock() *Clock {
+	return c.clock
+}
+
+// Fail makes every following call to method return err until cleared with a
+// nil error.
+func (c *Client) Fail(method string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err == nil {
+		delete(c.faults, method)
+		return
+	}
+	c.faults[method] = err
+}
+
+func (c *Client) Calls() []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.calls)
+}
+
+func (c *Client) CallCount(method string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	count := 0
+	for _, call := range c.calls {
+		if call.Method == method {
+			count++
+		}
+	}
+	return count
+}
+
+func (c *Client) ResetCalls() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = nil
+}
+
+// Peek returns the raw stored value without recording a call.
+func (c *Client) Peek(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lookup(key)
+}
+
+// TTL returns the remaining lifetime of key, or zero if it never expires.
+func (c *Client) TTL(key string) (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, found := c.lookup(key); !found {
+		return 0, false
+	}
+	expiresAt := c.entries[key].expiresAt
+	if expiresAt.IsZero() {
+		return 0, true
+	}
+	return expiresAt.Sub(c.clock.Now()), true
+}
+
+func (c *Client) lookup(key string) (string, bool) {
+	entry, exists := c.entries[key]
+	if !exists {
+		return "", false
+	}
+	if !entry.expiresAt.IsZero() && !c.clock.Now().Before(entry.expiresAt) {
+		delete(c.entries, key)
+		return "", false
+	}
+	return entry.value, true
+}
+
+func (c *Client) record(call Call) error {
+	c.calls = append(c.calls, call)
+	return c.faults[call.Method]
+}
+
+func (c *Client) Get(ctx context.Context, key string) (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.record(Call{Method: MethodGet, Keys: []string{key}}); err != nil {
+		return "", false, err
+	}
+	value, found := c.lookup(key)
+	return value, found, nil
+}
+
+func (c *Client) BulkSet(ctx context.Context, entries []cache.CacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.record(Call{Method: MethodBulkSet, Entries: slices.Clone(entries)}); err != nil {
+		return err
+	}
+	now := c.clock.Now()
+	for _, e := range entries {
+		var expiresAt time.Time
+		if e.TTL > 0 {
+			expiresAt = now.Add(e.TTL)
+		}
+		c.entries[e.Key] = entry{e.Value, expiresAt}
+	}
+	return nil
+}
+
+func (c *Client) BulkGet(ctx context.Context, keys ...string) ([]*string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.record(Call{Method: MethodBulkGet, Keys: slices.Clone(keys)}); err != nil {
+		return nil, err
+	}
+	values := make([]*string, len(keys))
+	for index, key := range keys {
+		if value, found := c.lookup(key); found {
+			values[index] = &value
+		}
+	}
+	return values, nil
+}
+
+func (c *Client) Delete(ctx context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.record(Call{Method: MethodDelete, Keys: slices.Clone(keys)}); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		delete(c.entries, key)
+	}
+	return nil
+}
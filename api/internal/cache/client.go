@@ -8,7 +8,9 @@ import (
 	"github.com/dgraph-io/ristretto/v2"
 	"github.com/redis/go-redis/v9"
 	"github.com/redis/go-redis/v9/maintnotifications"
+	"github.com/rs/zerolog"
 
+	"ftbadge/internal/config"
 	"ftbadge/internal/utils"
 )
 
@@ -28,8 +30,22 @@ type RedisClient struct {
 	client *redis.Client
 }
 
-func NewRedisClient() (*RedisClient, error) {
-	redisURL := utils.MustGetEnv("REDIS_URL")
+// NewClient returns the backend selected in cfg. logger reports the errors of
+// background work, such as disk cache compaction.
+func NewClient(cfg config.CacheConfig, logger zerolog.Logger) (CacheClient, error) {
+	switch cfg.Backend {
+	case "local":
+		return NewLocalClient()
+	case "redis":
+		return NewRedisClient(cfg.RedisURL)
+	case "disk":
+		return NewDiskClient(cfg.Disk, logger)
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", cfg.Backend)
+	}
+}
+
+func NewRedisClient(redisURL string) (*RedisClient, error) {
 	options, err := redis.ParseURL(redisURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse url %q: %w", redisURL, err)
@@ -42,6 +58,21 @@ func NewRedisClient() (*RedisClient, error) {
 	return &RedisClient{client}, nil
 }
 
+func (rc *RedisClient) Redis() *redis.Client {
+	return rc.client
+}
+
+// SharedRedis returns the connection of the Redis cache client, so that stores
+// shared between instances reuse it. name describes the store in the error
+// returned for other cache backends.
+func SharedRedis(cc CacheClient, name string) (*redis.Client, error) {
+	redisClient, ok := cc.(*RedisClient)
+	if !ok {
+		return nil, fmt.Errorf("%s requires the redis cache backend", name)
+	}
+	return redisClient.Redis(), nil
+}
+
 func (rc *RedisClient) Get(ctx context.Context, key string) (string, bool, error) {
 	value, err := rc.client.Get(ctx, key).Result()
 	if err == redis.Nil {
@@ -86,6 +117,7 @@ func NewLocalClient() (*LocalClient, error) {
 		NumCounters: 1e5,
 		MaxCost:     100 << 20,
 		BufferItems: 64,
+		Metrics:     true,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create local cache: %w", err)
@@ -123,3 +155,24 @@ func (lc *LocalClient) BulkGet(ctx context.Context, keys ...string) ([]*string,
 	}
 	return values, nil
 }
+
+// Pinger is implemented by clients backed by a resource that can become
+// unreachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+func Ping(ctx context.Context, client CacheClient) error {
+	pinger, ok := client.(Pinger)
+	if !ok {
+		return nil
+	}
+	return pinger.Ping(ctx)
+}
+
+func (rc *RedisClient) Ping(ctx context.Context) error {
+	if err := rc.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("failed to ping Redis: %w", err)
+	}
+	return nil
+}
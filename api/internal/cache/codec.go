@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"ftbadge/internal/utils"
+)
+
+// Encoded values start with a NUL byte followed by a format byte. Legacy
+// entries never start with NUL, so they are returned unchanged.
+const formatMarker = '\x00'
+
+type valueFormat byte
+
+const (
+	valueFormatRaw     valueFormat = 'r'
+	valueFormatGzip    valueFormat = 'g'
+	valueFormatDataURI valueFormat = 'd'
+)
+
+const minCompressedSize = 256
+
+var cacheKeyFormats = map[CacheKey]valueFormat{
+	CacheKeyAccessToken: valueFormatRaw,
+	CacheKeyProfile:     valueFormatGzip,
+	CacheKeyAvatar:      valueFormatDataURI,
+}
+
+// encodeRaw stores value unchanged, unless it starts like an encoded value.
+func encodeRaw(value string) string {
+	if len(value) > 0 && value[0] == formatMarker {
+		return string([]byte{formatMarker, byte(valueFormatRaw)}) + value
+	}
+	return value
+}
+
+func encodeValue(cacheKey CacheKey, value string) (string, error) {
+	format, exists := cacheKeyFormats[cacheKey]
+	if !exists || format == valueFormatRaw {
+		return encodeRaw(value), nil
+	}
+
+	switch format {
+	case valueFormatGzip:
+		if len(value) < minCompressedSize {
+			return encodeRaw(value), nil
+		}
+		compressed, err := utils.CompressGzip([]byte(value))
+		if err != nil {
+			return "", fmt.Errorf("failed to compress value for cache key %d: %w", cacheKey, err)
+		}
+		if len(compressed) >= len(value) {
+			return encodeRaw(value), nil
+		}
+		return string([]byte{formatMarker, byte(format)}) + string(compressed), nil
+	case valueFormatDataURI:
+		mimeType, data, err := utils.DataURIToBytes(value)
+		if err != nil {
+			return "", fmt.Errorf("failed to decode data URI for cache key %d: %w", cacheKey, err)
+		}
+		return string([]byte{formatMarker, byte(format)}) + mimeType + "\x00" + string(data), nil
+	default:
+		return "", fmt.Errorf("unknown value format %q for cache key %d", format, cacheKey)
+	}
+}
+
+func decodeValue(value string) (string, error) {
+	if len(value) < 2 || value[0] != formatMarker {
+		return value, nil
+	}
+
+	format, payload := valueFormat(value[1]), value[2:]
+	switch format {
+	case valueFormatRaw:
+		return payload, nil
+	case valueFormatGzip:
+		decompressed, err := utils.DecompressGzip(bytes.NewReader([]byte(payload)))
+		if err != nil {
+			return "", fmt.Errorf("failed to decompress cached value: %w", err)
+		}
+		return string(decompressed), nil
+	case valueFormatDataURI:
+		mimeType, data, found := strings.Cut(payload, "\x00")
+		if !found {
+			return "", fmt.Errorf("cached data URI value is missing its MIME type")
+		}
+		return utils.BytesToDataURI(mimeType, []byte(data)), nil
+	default:
+		return "", fmt.Errorf("unknown cached value format %q", format)
+	}
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"ftbadge/internal/utils"
+)
+
+func incompressible(size int) string {
+	random := rand.NewChaCha8([32]byte{})
+	data := make([]byte, size)
+	random.Read(data)
+	return string(data)
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	profile := `{"Name":"` + strings.Repeat("Test User ", 50) + `"}`
+	avatar := utils.BytesToDataURI("image/jpeg", []byte("\xff\xd8\xff\xe0 avatar"))
+
+	tests := []struct {
+		name     string
+		cacheKey CacheKey
+		value    string
+		format   valueFormat
+	}{
+		{"raw", CacheKeyAccessToken, "access token", 0},
+		{"raw starting with the marker", CacheKeyAccessToken, "\x00gtoken", valueFormatRaw},
+		{"gzip below threshold", CacheKeyProfile, strings.Repeat("a", minCompressedSize-1), 0},
+		{"gzip at threshold", CacheKeyProfile, strings.Repeat("a", minCompressedSize), valueFormatGzip},
+		{"gzip", CacheKeyProfile, profile, valueFormatGzip},
+		{"incompressible", CacheKeyProfile, incompressible(4 << 10), 0},
+		{"data URI", CacheKeyAvatar, avatar, valueFormatDataURI},
+		{"unknown key", CacheKey(-1), "value", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, err := encodeValue(test.cacheKey, test.value)
+			if err != nil {
+				t.Fatalf("Failed to encode value: %v", err)
+			}
+
+			// A zero format means the value is stored unchanged
+			if test.format == 0 && encoded != test.value {
+				t.Fatalf("Expected the value to be stored unchanged, got %.20q", encoded)
+			}
+			if test.format != 0 && (encoded[0] != formatMarker || valueFormat(encoded[1]) != test.format) {
+				t.Fatalf("Expected format %q, got %.20q", test.format, encoded)
+			}
+			if test.format != valueFormatRaw && test.format != 0 && len(encoded) >= len(test.value) {
+				t.Fatalf("Expected the encoded value to be smaller than %d bytes, got %d", len(test.value), len(encoded))
+			}
+
+			decoded, err := decodeValue(encoded)
+			if err != nil {
+				t.Fatalf("Failed to decode value: %v", err)
+			}
+			if decoded != test.value {
+				t.Fatalf("Expected %.20q after a round trip, got %.20q", test.value, decoded)
+			}
+		})
+	}
+}
+
+func TestDecodeLegacyValue(t *testing.T) {
+	for _, value := range []string{"", "<svg/>", "data:image/jpeg;base64,/9j/4A==", `{"Name":"Test User"}`} {
+		decoded, err := decodeValue(value)
+		if err != nil {
+			t.Fatalf("Failed to decode legacy value %q: %v", value, err)
+		}
+		if decoded != value {
+			t.Fatalf("Expected legacy value %q to be returned unchanged, got %q", value, decoded)
+		}
+	}
+
+	if decoded, err := decodeValue("\x00rraw"); err != nil || decoded != "raw" {
+		t.Fatalf("Expected a raw value to be unwrapped, got %q: %v", decoded, err)
+	}
+}
+
+func TestCodecErrors(t *testing.T) {
+	for _, avatar := range []string{"https://cdn.intra.42.fr/avatar.jpg", "data:image/jpeg,raw", "data:image/jpeg;base64,!!!"} {
+		if _, err := encodeValue(CacheKeyAvatar, avatar); err == nil {
+			t.Fatalf("Expected malformed data URI %q to be rejected", avatar)
+		}
+	}
+
+	for _, value := range []string{"\x00dimage/jpeg", "\x00gnot gzip", "\x00zunknown"} {
+		if _, err := decodeValue(value); err == nil {
+			t.Fatalf("Expected malformed value %q to be rejected", value)
+		}
+	}
+}
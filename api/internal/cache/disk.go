@@ -0,0 +1,439 @@
+package cache
+
+import (
+	"cmp"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	bolt "go.etcd.io/bbolt"
+
+	"ftbadge/internal/config"
+)
+
+var diskBucketName = []byte("cache")
+
+const (
+	diskHeaderSize  = 8
+	diskOpenTimeout = 5 * time.Second
+	// Writes over the maximum size evict down to this share of it, so that the
+	// following writes do not have to scan the cache again
+	diskEvictionTarget = 0.9
+	// The file is rewritten once at least this share of it is free pages
+	diskRewriteRatio  = 0.5
+	diskRewriteTxSize = 4 << 20
+)
+
+// DiskClient stores entries in a bbolt file. The total size of the entries is
+// kept under the configured maximum on every write, and the file itself is
+// rewritten to release the space freed by evictions, since bbolt never shrinks
+// it.
+type DiskClient struct {
+	path    string
+	maxSize int64
+	now     func() time.Time
+	open    func(path string) (*bolt.DB, error)
+	logger  zerolog.Logger
+
+	// Held for writing while the file is rewritten and swapped
+	mu sync.RWMutex
+	db *bolt.DB
+	// Set when the file could not be reopened after a rewrite, db is nil until
+	// the next compaction reopens it
+	dbErr error
+	// Serializes writes so that size matches the committed entries
+	writeMu sync.Mutex
+	size    int64
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+type diskEntryInfo struct {
+	key       []byte
+	size      int64
+	expiresAt int64
+}
+
+func openDiskDB(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: diskOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open disk cache %q: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(diskBucketName)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create disk cache bucket: %w", err)
+	}
+	return db, nil
+}
+
+func NewDiskClient(cfg config.DiskCacheConfig, logger zerolog.Logger) (*DiskClient, error) {
+	db, err := openDiskDB(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	dc := &DiskClient{
+		path:    cfg.Path,
+		maxSize: cfg.MaxSize,
+		now:     time.Now,
+		open:    openDiskDB,
+		logger:  logger,
+		db:      db,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if err := dc.Compact(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to compact disk cache on startup: %w", err)
+	}
+
+	if cfg.CompactionInterval > 0 {
+		go dc.compactionLoop(cfg.CompactionInterval)
+	} else {
+		close(dc.done)
+	}
+	return dc, nil
+}
+
+func (dc *DiskClient) unavailable() error {
+	return fmt.Errorf("disk cache is unavailable: %w", dc.dbErr)
+}
+
+func (dc *DiskClient) view(fn func(tx *bolt.Tx) error) error {
+	dc.mu.RLock()
+	defer dc.mu.RUnlock()
+	if dc.db == nil {
+		return dc.unavailable()
+	}
+	return dc.db.View(fn)
+}
+
+// update runs fn in a write transaction. fn returns the size of the stored
+// entries after its changes, which is only kept once the transaction commits.
+func (dc *DiskClient) update(fn func(tx *bolt.Tx, size int64) (int64, error)) error {
+	dc.mu.RLock()
+	defer dc.mu.RUnlock()
+	dc.writeMu.Lock()
+	defer dc.writeMu.Unlock()
+	if dc.db == nil {
+		return dc.unavailable()
+	}
+
+	var size int64
+	err := dc.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		size, err = fn(tx, dc.size)
+		return err
+	})
+	if err == nil {
+		dc.size = size
+	}
+	return err
+}
+
+func encodeDiskValue(value string, ttl time.Duration, now time.Time) []byte {
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = now.Add(ttl).UnixNano()
+	}
+
+	encoded := make([]byte, diskHeaderSize+len(value))
+	binary.BigEndian.PutUint64(encoded, uint64(expiresAt)) // #nosec G115 -- expiry is always a positive timestamp or zero
+	copy(encoded[diskHeaderSize:], value)
+	return encoded
+}
+
+func diskExpiry(encoded []byte) (int64, bool) {
+	if len(encoded) < diskHeaderSize {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint64(encoded)), true // #nosec G115 -- written by encodeDiskValue
+}
+
+func decodeDiskValue(encoded []byte, now time.Time) (string, bool) {
+	expiresAt, valid := diskExpiry(encoded)
+	if !valid || (expiresAt != 0 && expiresAt <= now.UnixNano()) {
+		return "", false
+	}
+	return string(encoded[diskHeaderSize:]), true
+}
+
+func diskEntrySize(key []byte, encoded []byte) int64 {
+	if encoded == nil {
+		return 0
+	}
+	return int64(len(key) + len(encoded))
+}
+
+func (dc *DiskClient) Get(ctx context.Context, key string) (string, bool, error) {
+	var value string
+	var found bool
+
+	err := dc.view(func(tx *bolt.Tx) error {
+		encoded := tx.Bucket(diskBucketName).Get([]byte(key))
+		if encoded != nil {
+			value, found = decodeDiskValue(encoded, dc.now())
+		}
+		return nil
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read key %q from disk cache: %w", key, err)
+	}
+	return value, found, nil
+}
+
+func (dc *DiskClient) BulkSet(ctx context.Context, entries []CacheEntry) error {
+	now := dc.now()
+	err := dc.update(func(tx *bolt.Tx, size int64) (int64, error) {
+		bucket := tx.Bucket(diskBucketName)
+		for _, entry := range entries {
+			key := []byte(entry.Key)
+			encoded := encodeDiskValue(entry.Value, entry.TTL, now)
+			size += diskEntrySize(key, encoded) - diskEntrySize(key, bucket.Get(key))
+			if err := bucket.Put(key, encoded); err != nil {
+				return 0, err
+			}
+		}
+
+		if dc.maxSize > 0 && size > dc.maxSize {
+			return evict(bucket, now.UnixNano(), int64(float64(dc.maxSize)*diskEvictionTarget))
+		}
+		return size, nil
+	})
+	if err != nil {
+		keys := make([]string, len(entries))
+		for index, entry := range entries {
+			keys[index] = entry.Key
+		}
+		return fmt.Errorf("failed to write keys %q to disk cache: %w", keys, err)
+	}
+	return nil
+}
+
+func (dc *DiskClient) BulkGet(ctx context.Context, keys ...string) ([]*string, error) {
+	values := make([]*string, len(keys))
+	now := dc.now()
+
+	err := dc.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(diskBucketName)
+		for index, key := range keys {
+			encoded := bucket.Get([]byte(key))
+			if encoded == nil {
+				continue
+			}
+			if value, found := decodeDiskValue(encoded, now); found {
+				values[index] = &value
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys %q from disk cache: %w", keys, err)
+	}
+	return values, nil
+}
+
+// evict removes expired entries, then the entries closest to expiry until the
+// stored values fit within target, and returns the size left. A zero target
+// only removes expired entries.
+func evict(bucket *bolt.Bucket, now int64, target int64) (int64, error) {
+	var removed [][]byte
+	var live []diskEntryInfo
+	var totalSize int64
+	err := bucket.ForEach(func(key, encoded []byte) error {
+		expiresAt, valid := diskExpiry(encoded)
+		if !valid || (expiresAt != 0 && expiresAt <= now) {
+			removed = append(removed, slices.Clone(key))
+			return nil
+		}
+
+		size := diskEntrySize(key, encoded)
+		live = append(live, diskEntryInfo{slices.Clone(key), size, expiresAt})
+		totalSize += size
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan disk cache: %w", err)
+	}
+
+	if target > 0 && totalSize > target {
+		slices.SortFunc(live, func(a, b diskEntryInfo) int {
+			// Entries without expiry are evicted last
+			if a.expiresAt == 0 || b.expiresAt == 0 {
+				return cmp.Compare(b.expiresAt, a.expiresAt)
+			}
+			return cmp.Compare(a.expiresAt, b.expiresAt)
+		})
+		for _, entry := range live {
+			if totalSize <= target {
+				break
+			}
+			removed = append(removed, entry.key)
+			totalSize -= entry.size
+		}
+	}
+
+	for _, key := range removed {
+		if err := bucket.Delete(key); err != nil {
+			return 0, fmt.Errorf("failed to delete key %q from disk cache: %w", key, err)
+		}
+	}
+	return totalSize, nil
+}
+
+// Compact removes expired entries and evicts the entries closest to expiry
+// until the stored values fit within the configured maximum size. The file is
+// then rewritten when most of it is free space. A file that could not be
+// reopened after a previous rewrite is reopened first.
+func (dc *DiskClient) Compact() error {
+	if err := dc.reopen(); err != nil {
+		return err
+	}
+
+	err := dc.update(func(tx *bolt.Tx, size int64) (int64, error) {
+		return evict(tx.Bucket(diskBucketName), dc.now().UnixNano(), dc.maxSize)
+	})
+	if err != nil {
+		return err
+	}
+
+	if !dc.needsRewrite() {
+		return nil
+	}
+	return dc.rewrite()
+}
+
+func (dc *DiskClient) reopen() error {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if dc.db != nil {
+		return nil
+	}
+
+	db, err := dc.open(dc.path)
+	if err != nil {
+		dc.dbErr = err
+		return fmt.Errorf("failed to reopen disk cache: %w", err)
+	}
+	dc.db, dc.dbErr = db, nil
+	return nil
+}
+
+func (dc *DiskClient) needsRewrite() bool {
+	dc.mu.RLock()
+	defer dc.mu.RUnlock()
+	if dc.db == nil {
+		return false
+	}
+
+	var fileSize int64
+	if err := dc.db.View(func(tx *bolt.Tx) error {
+		fileSize = tx.Size()
+		return nil
+	}); err != nil {
+		return false
+	}
+	stats := dc.db.Stats()
+	return fileSize > 0 && float64(stats.FreeAlloc) >= float64(fileSize)*diskRewriteRatio
+}
+
+// rewrite copies the live entries into a new file and swaps it with the
+// current one. Requests wait for the copy to finish. When the file cannot be
+// reopened, requests fail and readiness reports it until Compact reopens it.
+func (dc *DiskClient) rewrite() error {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	tmpPath := dc.path + ".compact"
+	if err := os.Remove(tmpPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale compacted disk cache %q: %w", tmpPath, err)
+	}
+	compacted, err := bolt.Open(tmpPath, 0o600, &bolt.Options{Timeout: diskOpenTimeout})
+	if err != nil {
+		return fmt.Errorf("failed to create compacted disk cache %q: %w", tmpPath, err)
+	}
+	if err := bolt.Compact(compacted, dc.db, diskRewriteTxSize); err != nil {
+		compacted.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to copy disk cache into %q: %w", tmpPath, err)
+	}
+	if err := compacted.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close compacted disk cache %q: %w", tmpPath, err)
+	}
+
+	if err := dc.db.Close(); err != nil {
+		return fmt.Errorf("failed to close disk cache: %w", err)
+	}
+	renameErr := os.Rename(tmpPath, dc.path)
+	// The previous file is reopened when the swap failed
+	db, err := dc.open(dc.path)
+	if err != nil {
+		dc.db, dc.dbErr = nil, err
+		return fmt.Errorf("failed to reopen disk cache after compaction: %w", err)
+	}
+	dc.db = db
+	if renameErr != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace disk cache with %q: %w", tmpPath, renameErr)
+	}
+	return nil
+}
+
+func (dc *DiskClient) compactionLoop(interval time.Duration) {
+	defer close(dc.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-dc.stop:
+			return
+		case <-ticker.C:
+			if err := dc.Compact(); err != nil {
+				dc.logger.Error().Err(err).Msg("failed to compact disk cache")
+			}
+		}
+	}
+}
+
+func (dc *DiskClient) Close() error {
+	dc.once.Do(func() { close(dc.stop) })
+	<-dc.done
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if dc.db == nil {
+		return nil
+	}
+	if err := dc.db.Close(); err != nil {
+		return fmt.Errorf("failed to close disk cache: %w", err)
+	}
+	return nil
+}
+
+func (dc *DiskClient) Ping(ctx context.Context) error {
+	err := dc.view(func(tx *bolt.Tx) error {
+		if tx.Bucket(diskBucketName) == nil {
+			return fmt.Errorf("bucket %q does not exist", diskBucketName)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read disk cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	bolt "go.etcd.io/bbolt"
+
+	"ftbadge/internal/config"
+)
+
+func newTestDiskClient(t *testing.T, maxSize int64) (*DiskClient, *time.Time) {
+	t.Helper()
+
+	dc, err := NewDiskClient(config.DiskCacheConfig{Path: filepath.Join(t.TempDir(), "cache.db"), MaxSize: maxSize}, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("Failed to open disk cache: %v", err)
+	}
+	t.Cleanup(func() { dc.Close() })
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	dc.now = func() time.Time { return now }
+	return dc, &now
+}
+
+func diskKeys(t *testing.T, dc *DiskClient) int {
+	t.Helper()
+
+	stats, err := dc.Stats(t.Context())
+	if err != nil {
+		t.Fatalf("Failed to get disk cache stats: %v", err)
+	}
+	return stats["keys"].(int)
+}
+
+func TestDiskClientExpiry(t *testing.T) {
+	dc, now := newTestDiskClient(t, 0)
+	entries := []CacheEntry{
+		{Key: "profile:testuser", Value: "profile", TTL: time.Hour},
+		{Key: "optout:testuser", Value: "1"},
+	}
+	if err := dc.BulkSet(t.Context(), entries); err != nil {
+		t.Fatalf("Failed to set entries: %v", err)
+	}
+
+	if value, found, err := dc.Get(t.Context(), "profile:testuser"); err != nil || !found || value != "profile" {
+		t.Fatalf("Expected the profile to be cached, got %q, %v, %v", value, found, err)
+	}
+
+	*now = now.Add(time.Hour)
+	values, err := dc.BulkGet(t.Context(), "profile:testuser", "optout:testuser")
+	if err != nil {
+		t.Fatalf("Failed to get entries: %v", err)
+	}
+	if values[0] != nil || values[1] == nil || *values[1] != "1" {
+		t.Fatalf("Expected only the entry without expiry to be left, got %v", values)
+	}
+
+	if err := dc.Compact(); err != nil {
+		t.Fatalf("Failed to compact disk cache: %v", err)
+	}
+	if keys := diskKeys(t, dc); keys != 1 {
+		t.Fatalf("Expected expired entries to be removed, got %d keys", keys)
+	}
+}
+
+func TestDiskClientEvictionOrder(t *testing.T) {
+	dc, _ := newTestDiskClient(t, 0)
+	value := strings.Repeat("x", 100)
+	entries := []CacheEntry{
+		{Key: "a", Value: value, TTL: 3 * time.Hour},
+		{Key: "b", Value: value, TTL: time.Hour},
+		{Key: "c", Value: value},
+		{Key: "d", Value: value, TTL: 2 * time.Hour},
+	}
+	if err := dc.BulkSet(t.Context(), entries); err != nil {
+		t.Fatalf("Failed to set entries: %v", err)
+	}
+
+	// Room for two entries
+	entrySize := diskEntrySize([]byte("a"), encodeDiskValue(value, time.Hour, dc.now()))
+	dc.maxSize = 2 * entrySize
+	if err := dc.Compact(); err != nil {
+		t.Fatalf("Failed to compact disk cache: %v", err)
+	}
+
+	values, err := dc.BulkGet(t.Context(), "a", "b", "c", "d")
+	if err != nil {
+		t.Fatalf("Failed to get entries: %v", err)
+	}
+	for index, expected := range []bool{true, false, true, false} {
+		if found := values[index] != nil; found != expected {
+			t.Fatalf("Expected entry %d to be kept=%v, got %v", index, expected, found)
+		}
+	}
+}
+
+func TestDiskClientSizeCap(t *testing.T) {
+	const maxSize = 4 << 10
+	dc, now := newTestDiskClient(t, maxSize)
+	value := strings.Repeat("x", 200)
+
+	for index := range 100 {
+		*now = now.Add(time.Second)
+		key := fmt.Sprintf("profile:%03d", index)
+		if err := dc.BulkSet(t.Context(), []CacheEntry{{Key: key, Value: value, TTL: time.Hour}}); err != nil {
+			t.Fatalf("Failed to set entry %d: %v", index, err)
+		}
+
+		stats, err := dc.Stats(t.Context())
+		if err != nil {
+			t.Fatalf("Failed to get disk cache stats: %v", err)
+		}
+		if size := stats["size"].(int64); size > maxSize {
+			t.Fatalf("Expected the size to stay under %d without compaction, got %d", maxSize, size)
+		}
+		if _, found, _ := dc.Get(t.Context(), key); !found {
+			t.Fatalf("Expected the latest entry %q to be kept", key)
+		}
+	}
+
+	// The oldest entries expire first, so they were evicted
+	if _, found, _ := dc.Get(t.Context(), "profile:000"); found {
+		t.Fatal("Expected the oldest entry to be evicted")
+	}
+}
+
+func TestDiskClientRewrite(t *testing.T) {
+	dc, _ := newTestDiskClient(t, 0)
+	value := strings.Repeat("x", 4<<10)
+
+	keys := make([]string, 500)
+	entries := make([]CacheEntry, len(keys))
+	for index := range keys {
+		keys[index] = fmt.Sprintf("avatar:%03d", index)
+		entries[index] = CacheEntry{Key: keys[index], Value: value, TTL: time.Hour}
+	}
+	if err := dc.BulkSet(t.Context(), entries); err != nil {
+		t.Fatalf("Failed to set entries: %v", err)
+	}
+	if err := dc.Delete(t.Context(), keys[1:]...); err != nil {
+		t.Fatalf("Failed to delete entries: %v", err)
+	}
+
+	before, err := os.Stat(dc.path)
+	if err != nil {
+		t.Fatalf("Failed to stat disk cache: %v", err)
+	}
+	if err := dc.Compact(); err != nil {
+		t.Fatalf("Failed to compact disk cache: %v", err)
+	}
+	after, err := os.Stat(dc.path)
+	if err != nil {
+		t.Fatalf("Failed to stat disk cache: %v", err)
+	}
+	if after.Size() >= before.Size()/2 {
+		t.Fatalf("Expected the file to shrink from %d bytes, got %d", before.Size(), after.Size())
+	}
+
+	if cached, found, err := dc.Get(t.Context(), keys[0]); err != nil || !found || cached != value {
+		t.Fatalf("Expected the remaining entry to survive the rewrite, got %v, %v", found, err)
+	}
+	if err := dc.BulkSet(t.Context(), []CacheEntry{{Key: "profile:testuser", Value: "profile"}}); err != nil {
+		t.Fatalf("Failed to write after the rewrite: %v", err)
+	}
+}
+
+func TestDiskClientReopenAfterFailedRewrite(t *testing.T) {
+	dc, _ := newTestDiskClient(t, 0)
+	value := strings.Repeat("x", 4<<10)
+
+	entries := make([]CacheEntry, 500)
+	for index := range entries {
+		entries[index] = CacheEntry{Key: fmt.Sprintf("avatar:%03d", index), Value: value, TTL: time.Hour}
+	}
+	if err := dc.BulkSet(t.Context(), entries); err != nil {
+		t.Fatalf("Failed to set entries: %v", err)
+	}
+	if err := dc.Delete(t.Context(), "avatar:001", "avatar:002"); err != nil {
+		t.Fatalf("Failed to delete entries: %v", err)
+	}
+
+	openErr := errors.New("disk is full")
+	dc.open = func(path string) (*bolt.DB, error) { return nil, openErr }
+	if err := dc.rewrite(); !errors.Is(err, openErr) {
+		t.Fatalf("Expected the rewrite to fail on reopen, got %v", err)
+	}
+	if err := dc.Ping(t.Context()); !errors.Is(err, openErr) {
+		t.Fatalf("Expected the ping to report the reopen failure, got %v", err)
+	}
+	if _, _, err := dc.Get(t.Context(), "avatar:000"); err == nil {
+		t.Fatal("Expected reads to fail while the file is closed")
+	}
+	if err := dc.Compact(); !errors.Is(err, openErr) {
+		t.Fatalf("Expected the compaction to fail while the file cannot be opened, got %v", err)
+	}
+
+	dc.open = openDiskDB
+	if err := dc.Compact(); err != nil {
+		t.Fatalf("Failed to compact disk cache: %v", err)
+	}
+	if err := dc.Ping(t.Context()); err != nil {
+		t.Fatalf("Expected the reopened cache to be healthy, got %v", err)
+	}
+	if cached, found, err := dc.Get(t.Context(), "avatar:000"); err != nil || !found || cached != value {
+		t.Fatalf("Expected the entry to survive the reopen, got %v, %v", found, err)
+	}
+	if stats, err := dc.Stats(t.Context()); err != nil || stats["size"].(int64) == 0 {
+		t.Fatalf("Expected the size to be counted again after the reopen, got %v, %v", stats, err)
+	}
+}
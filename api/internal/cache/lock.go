@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type UnlockFunc func(ctx context.Context) error
+
+// Locker is implemented by clients shared between instances, so that only one
+// instance does the expensive work behind a cache miss.
+type Locker interface {
+	TryLock(ctx context.Context, key string, ttl time.Duration) (UnlockFunc, bool, error)
+}
+
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func noopUnlock(ctx context.Context) error { return nil }
+
+func (rc *RedisClient) TryLock(ctx context.Context, key string, ttl time.Duration) (UnlockFunc, bool, error) {
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, false, fmt.Errorf("failed to generate lock token: %w", err)
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	acquired, err := rc.client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to acquire lock %q in Redis: %w", key, err)
+	}
+	if !acquired {
+		return nil, false, nil
+	}
+
+	unlock := func(ctx context.Context) error {
+		if err := unlockScript.Run(ctx, rc.client, []string{key}, token).Err(); err != nil {
+			return fmt.Errorf("failed to release lock %q in Redis: %w", key, err)
+		}
+		return nil
+	}
+	return unlock, true, nil
+}
+
+// TryLock always succeeds when the underlying client is not shared between
+// instances.
+func (cm *CacheManager) TryLock(ctx context.Context, cacheKey CacheKey, ttl time.Duration) (UnlockFunc, bool, error) {
+	locker, ok := cm.client.(Locker)
+	if !ok {
+		return noopUnlock, true, nil
+	}
+
+	cacheKeyGenerator, exists := cacheKeyGenerators[cacheKey]
+	if !exists {
+		return nil, false, fmt.Errorf("cache key %d does not have a corresponding generator function", cacheKey)
+	}
+	key := "lock:" + cacheKeyGenerator(cm.id)
+
+	return locker.TryLock(ctx, key, ttl)
+}
@@ -0,0 +1,88 @@
+package cache_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"ftbadge/internal/cache"
+	"ftbadge/internal/cache/cachetest"
+)
+
+func newTestRedisClient(t *testing.T) (*cache.RedisClient, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	rc, err := cache.NewRedisClient("redis://" + server.Addr())
+	if err != nil {
+		t.Fatalf("Failed to create Redis client: %v", err)
+	}
+	return rc, server
+}
+
+func TestTryLockReleasesOnlyOwnLock(t *testing.T) {
+	rc, server := newTestRedisClient(t)
+
+	unlock, acquired, err := rc.TryLock(t.Context(), "lock:profile:testuser", time.Second)
+	if err != nil || !acquired {
+		t.Fatalf("Expected the lock to be acquired, got %v, %v", acquired, err)
+	}
+	if _, acquired, _ := rc.TryLock(t.Context(), "lock:profile:testuser", time.Second); acquired {
+		t.Fatal("Expected a held lock not to be acquired again")
+	}
+
+	// The lock expires while its first holder is still working
+	server.FastForward(2 * time.Second)
+	_, acquired, err = rc.TryLock(t.Context(), "lock:profile:testuser", time.Second)
+	if err != nil || !acquired {
+		t.Fatalf("Expected the expired lock to be acquired, got %v, %v", acquired, err)
+	}
+
+	if err := unlock(t.Context()); err != nil {
+		t.Fatalf("Failed to release lock: %v", err)
+	}
+	if !server.Exists("lock:profile:testuser") {
+		t.Fatal("Expected the first holder not to release the lock of the new holder")
+	}
+}
+
+func TestTryLockConcurrent(t *testing.T) {
+	rc, _ := newTestRedisClient(t)
+	cm := newManager(t, rc, "testuser")
+
+	var acquired atomic.Int32
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			_, ok, err := cm.TryLock(t.Context(), cache.CacheKeyProfile, time.Minute)
+			if err != nil {
+				t.Errorf("Failed to try lock: %v", err)
+			}
+			if ok {
+				acquired.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+
+	if count := acquired.Load(); count != 1 {
+		t.Fatalf("Expected exactly one request to acquire the lock, got %d", count)
+	}
+}
+
+func TestTryLockWithoutLocker(t *testing.T) {
+	cm := newManager(t, cachetest.NewClient(nil), "testuser")
+
+	for range 2 {
+		unlock, acquired, err := cm.TryLock(t.Context(), cache.CacheKeyProfile, time.Minute)
+		if err != nil || !acquired {
+			t.Fatalf("Expected clients without locking to always acquire, got %v, %v", acquired, err)
+		}
+		if err := unlock(t.Context()); err != nil {
+			t.Fatalf("Failed to release lock: %v", err)
+		}
+	}
+}
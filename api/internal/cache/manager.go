@@ -3,7 +3,13 @@ package cache
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"ftbadge/internal/metrics"
+	"ftbadge/internal/tracing"
 )
 
 type CacheManager struct {
@@ -19,39 +25,77 @@ const (
 	CacheKeyAccessToken CacheKey = iota
 	CacheKeyProfile
 	CacheKeyAvatar
+	// Set when a profile failed to render, so that concurrent and following
+	// requests fail without calling the Intra API again
+	CacheKeyProfileFailure
 )
 
 var CacheKeys = []CacheKey{
 	CacheKeyAccessToken,
 	CacheKeyProfile,
 	CacheKeyAvatar,
+	CacheKeyProfileFailure,
+}
+
+var cacheKeyNames = map[CacheKey]string{
+	CacheKeyAccessToken:    "access_token",
+	CacheKeyProfile:        "profile",
+	CacheKeyAvatar:         "avatar",
+	CacheKeyProfileFailure: "profile_failure",
+}
+
+func (k CacheKey) String() string {
+	if name, exists := cacheKeyNames[k]; exists {
+		return name
+	}
+	return "unknown"
 }
 
+const (
+	AvatarDisplaySize = 100
+	AvatarPixelRatio  = 2
+	// AvatarSize is the width of cached avatars. It is part of their key so
+	// avatars of a previous size are not served once it changes.
+	AvatarSize = AvatarDisplaySize * AvatarPixelRatio
+)
+
 type CacheGroup int
 
 const (
 	CacheGroupProfile CacheGroup = iota
 	CacheGroupData
+	// Read after a profile miss, before rendering or while waiting for the
+	// instance rendering it
+	CacheGroupRender
 )
 
 var preFetchGroups = map[CacheGroup][]CacheKey{
 	CacheGroupProfile: {CacheKeyProfile},
 	CacheGroupData:    {CacheKeyAccessToken, CacheKeyAvatar},
+	CacheGroupRender:  {CacheKeyProfile, CacheKeyProfileFailure},
 }
 
-func generateAccessTokenKey(id string) string { return "access-token" }
-func generateProfileKey(id string) string     { return "profile:" + id }
-func generateAvatarKey(id string) string      { return "avatar:" + id }
+func generateAccessTokenKey(id string) string    { return "access-token" }
+func generateProfileKey(id string) string        { return "profile:" + id }
+func generateAvatarKey(id string) string         { return "avatar:" + id + ":" + strconv.Itoa(AvatarSize) }
+func generateProfileFailureKey(id string) string { return "profile-failure:" + id }
 
 var cacheKeyGenerators = map[CacheKey]func(id string) string{
-	CacheKeyAccessToken: generateAccessTokenKey,
-	CacheKeyProfile:     generateProfileKey,
-	CacheKeyAvatar:      generateAvatarKey,
+	CacheKeyAccessToken:    generateAccessTokenKey,
+	CacheKeyProfile:        generateProfileKey,
+	CacheKeyAvatar:         generateAvatarKey,
+	CacheKeyProfileFailure: generateProfileFailureKey,
 }
 
 var cacheKeyTTL = map[CacheKey]time.Duration{
-	CacheKeyProfile: 24 * time.Hour,
-	CacheKeyAvatar:  7 * 24 * time.Hour,
+	CacheKeyProfile:        24 * time.Hour,
+	CacheKeyAvatar:         7 * 24 * time.Hour,
+	CacheKeyProfileFailure: time.Minute,
+}
+
+func DefaultTTL(cacheKey CacheKey) (time.Duration, bool) {
+	ttl, exists := cacheKeyTTL[cacheKey]
+	return ttl, exists
 }
 
 func NewCacheManager(ctx context.Context, client CacheClient, id string) (*CacheManager, error) {
@@ -62,6 +106,13 @@ func NewCacheManager(ctx context.Context, client CacheClient, id string) (*Cache
 }
 
 func (cm *CacheManager) PreFetch(ctx context.Context, group CacheGroup) error {
+	ctx, span := tracing.Start(ctx, "CacheManager.PreFetch", attribute.Int("cache.group", int(group)))
+	err := cm.preFetch(ctx, group)
+	tracing.End(span, err)
+	return err
+}
+
+func (cm *CacheManager) preFetch(ctx context.Context, group CacheGroup) error {
 	keys, exists := preFetchGroups[group]
 	if !exists {
 		return fmt.Errorf("pre-fetch group %d does not exist", group)
@@ -79,27 +130,45 @@ func (cm *CacheManager) PreFetch(ctx context.Context, group CacheGroup) error {
 	if len(cacheKeys) > 1 {
 		cacheValues, err := cm.client.BulkGet(ctx, cacheKeys...)
 		if err != nil {
-			return fmt.Errorf("failed to bulk get cache values for pre-fetch group %q: %w", group, err)
+			return fmt.Errorf("failed to bulk get cache values for pre-fetch group %d: %w", group, err)
 		}
 
 		for index, key := range keys {
+			recordLookup(key, cacheValues[index] != nil)
 			if value := cacheValues[index]; value != nil {
-				cm.data[key] = *value
+				decoded, err := decodeValue(*value)
+				if err != nil {
+					return fmt.Errorf("failed to decode cache value for key %d in pre-fetch group %d: %w", key, group, err)
+				}
+				cm.data[key] = decoded
 			}
 		}
 	} else {
 		value, exists, err := cm.client.Get(ctx, cacheKeys[0])
 		if err != nil {
-			return fmt.Errorf("failed to get cache value for key %q in pre-fetch group %q: %w", keys[0], group, err)
+			return fmt.Errorf("failed to get cache value for key %d in pre-fetch group %d: %w", keys[0], group, err)
 		}
+		recordLookup(keys[0], exists)
 		if exists {
-			cm.data[keys[0]] = value
+			decoded, err := decodeValue(value)
+			if err != nil {
+				return fmt.Errorf("failed to decode cache value for key %d in pre-fetch group %d: %w", keys[0], group, err)
+			}
+			cm.data[keys[0]] = decoded
 		}
 	}
 
 	return nil
 }
 
+func recordLookup(cacheKey CacheKey, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	metrics.CacheLookups.WithLabelValues(cacheKey.String(), result).Inc()
+}
+
 func (cm *CacheManager) Get(cacheKey CacheKey) (string, bool) {
 	value, exists := cm.data[cacheKey]
 	return value, exists
@@ -125,9 +194,14 @@ func (cm *CacheManager) SetWithTTL(cacheKey CacheKey, value string, ttl time.Dur
 	}
 	key := cacheKeyGenerator(cm.id)
 
+	encoded, err := encodeValue(cacheKey, value)
+	if err != nil {
+		return fmt.Errorf("failed to encode value for cache key %d: %w", cacheKey, err)
+	}
+
 	entry := CacheEntry{
 		Key:   key,
-		Value: value,
+		Value: encoded,
 		TTL:   ttl,
 	}
 	cm.pending = append(cm.pending, entry)
@@ -135,6 +209,13 @@ func (cm *CacheManager) SetWithTTL(cacheKey CacheKey, value string, ttl time.Dur
 }
 
 func (cm *CacheManager) Flush(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "CacheManager.Flush", attribute.Int("cache.pending", len(cm.pending)))
+	err := cm.flush(ctx)
+	tracing.End(span, err)
+	return err
+}
+
+func (cm *CacheManager) flush(ctx context.Context) error {
 	if cm.pending == nil {
 		return nil
 	}
@@ -0,0 +1,170 @@
+package cache_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"ftbadge/internal/cache"
+	"ftbadge/internal/cache/cachetest"
+)
+
+var profileSVG = "<svg>" + strings.Repeat("<text>testuser</text>", 50) + "</svg>"
+
+func newManager(t *testing.T, cc cache.CacheClient, id string) *cache.CacheManager {
+	t.Helper()
+
+	cm, err := cache.NewCacheManager(t.Context(), cc, id)
+	if err != nil {
+		t.Fatalf("Failed to create cache manager: %v", err)
+	}
+	return cm
+}
+
+func TestPreFetchProfileGroupUsesGet(t *testing.T) {
+	cc := cachetest.NewClient(nil)
+	cc.BulkSet(t.Context(), []cache.CacheEntry{{Key: "profile:testuser", Value: "<svg/>", TTL: time.Hour}})
+	cc.ResetCalls()
+
+	cm := newManager(t, cc, "testuser")
+	if err := cm.PreFetch(t.Context(), cache.CacheGroupProfile); err != nil {
+		t.Fatalf("Failed to pre-fetch profile group: %v", err)
+	}
+
+	calls := cc.Calls()
+	if len(calls) != 1 || calls[0].Method != cachetest.MethodGet || calls[0].Keys[0] != "profile:testuser" {
+		t.Fatalf("Expected a single Get for profile:testuser, got %+v", calls)
+	}
+	if value, found := cm.Get(cache.CacheKeyProfile); !found || value != "<svg/>" {
+		t.Fatalf("Expected legacy profile value to be readable, got %q (found=%t)", value, found)
+	}
+}
+
+func TestPreFetchDataGroupUsesBulkGet(t *testing.T) {
+	cc := cachetest.NewClient(nil)
+	cc.BulkSet(t.Context(), []cache.CacheEntry{{Key: "access-token", Value: "token", TTL: time.Hour}})
+	cc.ResetCalls()
+
+	cm := newManager(t, cc, "testuser")
+	if err := cm.PreFetch(t.Context(), cache.CacheGroupData); err != nil {
+		t.Fatalf("Failed to pre-fetch data group: %v", err)
+	}
+
+	calls := cc.Calls()
+	if len(calls) != 1 || calls[0].Method != cachetest.MethodBulkGet || len(calls[0].Keys) != 2 {
+		t.Fatalf("Expected a single BulkGet for two keys, got %+v", calls)
+	}
+	if value, found := cm.Get(cache.CacheKeyAccessToken); !found || value != "token" {
+		t.Fatalf("Expected cached access token, got %q (found=%t)", value, found)
+	}
+	if _, found := cm.Get(cache.CacheKeyAvatar); found {
+		t.Fatal("Expected avatar to be missing")
+	}
+}
+
+func TestPreFetchIgnoresExpiredEntries(t *testing.T) {
+	cc := cachetest.NewClient(nil)
+	cc.BulkSet(t.Context(), []cache.CacheEntry{{Key: "profile:testuser", Value: "<svg/>", TTL: time.Minute}})
+	cc.Clock().Advance(time.Minute)
+
+	cm := newManager(t, cc, "testuser")
+	if err := cm.PreFetch(t.Context(), cache.CacheGroupProfile); err != nil {
+		t.Fatalf("Failed to pre-fetch profile group: %v", err)
+	}
+	if _, found := cm.Get(cache.CacheKeyProfile); found {
+		t.Fatal("Expected expired profile to be missing")
+	}
+}
+
+func TestPreFetchReturnsClientErrors(t *testing.T) {
+	cc := cachetest.NewClient(nil)
+	failure := errors.New("connection refused")
+	cc.Fail(cachetest.MethodBulkGet, failure)
+
+	cm := newManager(t, cc, "testuser")
+	if err := cm.PreFetch(t.Context(), cache.CacheGroupData); !errors.Is(err, failure) {
+		t.Fatalf("Expected injected error, got %v", err)
+	}
+	if err := cm.PreFetch(t.Context(), cache.CacheGroup(42)); err == nil {
+		t.Fatal("Expected error for unknown pre-fetch group")
+	}
+}
+
+func TestSetIsDeferredUntilFlush(t *testing.T) {
+	cc := cachetest.NewClient(nil)
+	cm := newManager(t, cc, "testuser")
+
+	if err := cm.Set(cache.CacheKeyProfile, profileSVG); err != nil {
+		t.Fatalf("Failed to set profile: %v", err)
+	}
+	if err := cm.SetWithTTL(cache.CacheKeyAccessToken, "token", time.Minute); err != nil {
+		t.Fatalf("Failed to set access token: %v", err)
+	}
+	if len(cc.Calls()) != 0 {
+		t.Fatalf("Expected no client calls before flush, got %+v", cc.Calls())
+	}
+
+	if err := cm.Flush(t.Context()); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	calls := cc.Calls()
+	if len(calls) != 1 || calls[0].Method != cachetest.MethodBulkSet || len(calls[0].Entries) != 2 {
+		t.Fatalf("Expected a single BulkSet with two entries, got %+v", calls)
+	}
+
+	if ttl, found := cc.TTL("profile:testuser"); !found || ttl != 24*time.Hour {
+		t.Fatalf("Expected profile TTL of 24h, got %v (found=%t)", ttl, found)
+	}
+	if ttl, found := cc.TTL("access-token"); !found || ttl != time.Minute {
+		t.Fatalf("Expected access token TTL of 1m, got %v (found=%t)", ttl, found)
+	}
+	if raw, _ := cc.Peek("profile:testuser"); len(raw) >= len(profileSVG) {
+		t.Fatalf("Expected profile to be stored compressed, got %d bytes for %d", len(raw), len(profileSVG))
+	}
+}
+
+func TestSetWithoutDefaultTTL(t *testing.T) {
+	cm := newManager(t, cachetest.NewClient(nil), "testuser")
+	if err := cm.Set(cache.CacheKeyAccessToken, "token"); err == nil {
+		t.Fatal("Expected error when setting a key without a default TTL")
+	}
+}
+
+func TestFlush(t *testing.T) {
+	cc := cachetest.NewClient(nil)
+	cm := newManager(t, cc, "testuser")
+
+	if err := cm.Flush(t.Context()); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if count := cc.CallCount(cachetest.MethodBulkSet); count != 0 {
+		t.Fatalf("Expected no BulkSet without pending entries, got %d", count)
+	}
+
+	failure := errors.New("read only replica")
+	cc.Fail(cachetest.MethodBulkSet, failure)
+	cm.Set(cache.CacheKeyProfile, profileSVG)
+	if err := cm.Flush(t.Context()); !errors.Is(err, failure) {
+		t.Fatalf("Expected injected error, got %v", err)
+	}
+
+	cc.Fail(cachetest.MethodBulkSet, nil)
+	if err := cm.Flush(t.Context()); err != nil {
+		t.Fatalf("Failed to flush after recovery: %v", err)
+	}
+	if err := cm.Flush(t.Context()); err != nil {
+		t.Fatalf("Failed to flush twice: %v", err)
+	}
+	if count := cc.CallCount(cachetest.MethodBulkSet); count != 2 {
+		t.Fatalf("Expected pending entries to be retried once and then cleared, got %d BulkSet calls", count)
+	}
+
+	other := newManager(t, cc, "testuser")
+	if err := other.PreFetch(t.Context(), cache.CacheGroupProfile); err != nil {
+		t.Fatalf("Failed to pre-fetch profile group: %v", err)
+	}
+	if value, found := other.Get(cache.CacheKeyProfile); !found || value != profileSVG {
+		t.Fatalf("Expected flushed profile to round-trip, got %d bytes (found=%t)", len(value), found)
+	}
+}
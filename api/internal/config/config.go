@@ -0,0 +1,187 @@
+package config
+
+import (
+	"time"
+)
+
+type Config struct {
+	Port      string          `yaml:"port" toml:"port" env:"PORT" validate:"required,numeric"`
+	Reporting ReportingConfig `yaml:"reporting" toml:"reporting"`
+	Intra     IntraConfig     `yaml:"intra" toml:"intra"`
+	Cache     CacheConfig     `yaml:"cache" toml:"cache"`
+	RateLimit RateLimitConfig `yaml:"rate_limit" toml:"rate_limit"`
+	APIKeys   APIKeyConfig    `yaml:"api_keys" toml:"api_keys"`
+	State     StateConfig     `yaml:"state" toml:"state"`
+	Admin     AdminConfig     `yaml:"admin" toml:"admin"`
+	Auth      AuthConfig      `yaml:"auth" toml:"auth"`
+	Warmup    WarmupConfig    `yaml:"warmup" toml:"warmup"`
+	Tracing   TracingConfig   `yaml:"tracing" toml:"tracing"`
+	// Metrics are served on their own port so that they are not public, they
+	// are disabled when empty
+	MetricsPort string `yaml:"metrics_port" toml:"metrics_port" env:"METRICS_PORT" validate:"omitempty,numeric,nefield=Port"`
+}
+
+type ReportingConfig struct {
+	// Defaults to "sentry" when a DSN is set and "log" otherwise
+	Reporter  string `yaml:"reporter" toml:"reporter" env:"ERROR_REPORTER" validate:"omitempty,oneof=sentry log none"`
+	SentryDSN string `yaml:"sentry_dsn" toml:"sentry_dsn" env:"SENTRY_DSN" validate:"required_if=Reporter sentry,omitempty,url"`
+}
+
+type IntraConfig struct {
+	APIBaseURL   string        `yaml:"api_base_url" toml:"api_base_url" env:"FT_API_BASE_URL" validate:"required,url"`
+	CDNBaseURL   string        `yaml:"cdn_base_url" toml:"cdn_base_url" env:"FT_CDN_BASE_URL" validate:"required,url"`
+	ClientID     string        `yaml:"client_id" toml:"client_id" env:"FT_CLIENT_ID" validate:"required"`
+	ClientSecret string        `yaml:"client_secret" toml:"client_secret" env:"FT_CLIENT_SECRET" validate:"required"`
+	Timeout      time.Duration `yaml:"timeout" toml:"timeout" env:"FT_TIMEOUT" validate:"gt=0"`
+	// Avatars are only fetched from the CDN host and these additional hosts
+	AvatarHosts        []string `yaml:"avatar_hosts" toml:"avatar_hosts" env:"FT_AVATAR_HOSTS" validate:"dive,hostname"`
+	AvatarMaxBytes     int64    `yaml:"avatar_max_bytes" toml:"avatar_max_bytes" env:"FT_AVATAR_MAX_BYTES" validate:"gt=0"`
+	AvatarMaxDimension int      `yaml:"avatar_max_dimension" toml:"avatar_max_dimension" env:"FT_AVATAR_MAX_DIMENSION" validate:"gt=0"`
+}
+
+type CacheConfig struct {
+	Backend  string          `yaml:"backend" toml:"backend" env:"CACHE_BACKEND" validate:"oneof=local redis disk"`
+	RedisURL string          `yaml:"redis_url" toml:"redis_url" env:"REDIS_URL" validate:"required_if=Backend redis,omitempty,url"`
+	Disk     DiskCacheConfig `yaml:"disk" toml:"disk"`
+}
+
+type DiskCacheConfig struct {
+	Path string `yaml:"path" toml:"path" env:"CACHE_DISK_PATH" validate:"required"`
+	// Total size of the stored values in bytes, enforced on every write. Zero
+	// is unlimited. The file is rewritten on compaction to release the space
+	// of evicted entries.
+	MaxSize            int64         `yaml:"max_size" toml:"max_size" env:"CACHE_DISK_MAX_SIZE" validate:"gte=0"`
+	CompactionInterval time.Duration `yaml:"compaction_interval" toml:"compaction_interval" env:"CACHE_DISK_COMPACTION_INTERVAL" validate:"gte=0"`
+}
+
+type RateLimitConfig struct {
+	// The redis store shares limits between instances and requires the redis cache backend
+	Store  string        `yaml:"store" toml:"store" env:"RATE_LIMIT_STORE" validate:"oneof=memory redis"`
+	Global LimiterConfig `yaml:"global" toml:"global" env:"RATE_LIMIT_GLOBAL"`
+	// Profile limits are keyed by client IP and Login limits by client IP or
+	// API key, charged once per distinct login within ExpiresIn. Both are only
+	// charged when a profile is fetched from the Intra API.
+	Profile LimiterConfig `yaml:"profile" toml:"profile" env:"RATE_LIMIT_PROFILE"`
+	Login   LimiterConfig `yaml:"login" toml:"login" env:"RATE_LIMIT_LOGIN"`
+}
+
+type LimiterConfig struct {
+	Rate      float64       `yaml:"rate" toml:"rate" env:"RATE" validate:"gt=0"`
+	Burst     int           `yaml:"burst" toml:"burst" env:"BURST" validate:"gt=0"`
+	ExpiresIn time.Duration `yaml:"expires_in" toml:"expires_in" env:"EXPIRES_IN" validate:"gt=0"`
+}
+
+type APIKeyConfig struct {
+	// Keys and their usage are kept in the state store
+	Enabled    bool   `yaml:"enabled" toml:"enabled" env:"API_KEY_ENABLED"`
+	Header     string `yaml:"header" toml:"header" env:"API_KEY_HEADER" validate:"required"`
+	QueryParam string `yaml:"query_param" toml:"query_param" env:"API_KEY_QUERY_PARAM" validate:"required"`
+	// Defaults for newly issued keys, charged like the profile limiter
+	Limit      LimiterConfig `yaml:"limit" toml:"limit" env:"API_KEY_LIMIT"`
+	DailyQuota int64         `yaml:"daily_quota" toml:"daily_quota" env:"API_KEY_DAILY_QUOTA" validate:"gte=0"`
+	// Usage is counted in memory and written to the store at this interval, so
+	// the quota shared between instances is only enforced approximately
+	FlushInterval time.Duration `yaml:"flush_interval" toml:"flush_interval" env:"API_KEY_FLUSH_INTERVAL" validate:"gt=0"`
+}
+
+type StateConfig struct {
+	// Opt-outs, preferences, API keys and admin settings are kept in this
+	// store, which is never evicted unlike the cache. The bolt store is a local
+	// file, so with several instances each one has its own opt-outs, blocklist
+	// and maintenance mode: use the redis store, which requires the redis cache
+	// backend.
+	Store string `yaml:"store" toml:"store" env:"STATE_STORE" validate:"oneof=bolt redis"`
+	Path  string `yaml:"path" toml:"path" env:"STATE_PATH" validate:"required_if=Store bolt"`
+}
+
+type AdminConfig struct {
+	// Admin routes are disabled without a token
+	Token string `yaml:"token" toml:"token" env:"ADMIN_TOKEN" validate:"omitempty,min=16"`
+	// Added to the blocklist of the state store on startup, so these logins are
+	// blocked again after a restart even if they were unblocked through the API
+	Blocklist []string `yaml:"blocklist" toml:"blocklist" env:"ADMIN_BLOCKLIST" validate:"dive,alphanum,max=32"`
+	// Maintenance mode and the blocklist are shared through the state store,
+	// each instance reads them again at this interval
+	RefreshInterval time.Duration `yaml:"refresh_interval" toml:"refresh_interval" env:"ADMIN_REFRESH_INTERVAL" validate:"gt=0"`
+}
+
+type AuthConfig struct {
+	// Student self-service is disabled without a redirect URL, which must point
+	// to the /auth/callback route and be registered on the Intra application
+	RedirectURL   string        `yaml:"redirect_url" toml:"redirect_url" env:"AUTH_REDIRECT_URL" validate:"omitempty,url"`
+	SessionSecret string        `yaml:"session_secret" toml:"session_secret" env:"AUTH_SESSION_SECRET" validate:"required_with=RedirectURL,omitempty,min=32"`
+	SessionTTL    time.Duration `yaml:"session_ttl" toml:"session_ttl" env:"AUTH_SESSION_TTL" validate:"gt=0"`
+	SecureCookies bool          `yaml:"secure_cookies" toml:"secure_cookies" env:"AUTH_SECURE_COOKIES"`
+}
+
+type WarmupConfig struct {
+	Logins          []string      `yaml:"logins" toml:"logins" env:"WARMUP_LOGINS" validate:"dive,alphanum,max=32"`
+	StatsPath       string        `yaml:"stats_path" toml:"stats_path" env:"WARMUP_STATS_PATH"`
+	TopN            int           `yaml:"top_n" toml:"top_n" env:"REFRESH_TOP_N" validate:"gte=0"`
+	Interval        time.Duration `yaml:"interval" toml:"interval" env:"REFRESH_INTERVAL" validate:"gt=0"`
+	Margin          time.Duration `yaml:"margin" toml:"margin" env:"REFRESH_MARGIN" validate:"gte=0"`
+	RequestInterval time.Duration `yaml:"request_interval" toml:"request_interval" env:"REFRESH_REQUEST_INTERVAL" validate:"gt=0"`
+}
+
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter" toml:"exporter" env:"TRACING_EXPORTER" validate:"oneof=none otlp stdout"`
+	ServiceName string  `yaml:"service_name" toml:"service_name" env:"TRACING_SERVICE_NAME" validate:"required"`
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint" env:"TRACING_ENDPOINT" validate:"omitempty,url"`
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" validate:"gte=0,lte=1"`
+}
+
+func Default() *Config {
+	return &Config{
+		Port:        "3000",
+		MetricsPort: "9090",
+		Intra: IntraConfig{
+			APIBaseURL:         "https://api.intra.42.fr/v2",
+			CDNBaseURL:         "https://cdn.intra.42.fr",
+			Timeout:            10 * time.Second,
+			AvatarMaxBytes:     5 << 20,
+			AvatarMaxDimension: 4096,
+		},
+		Cache: CacheConfig{
+			Backend: "local",
+			Disk: DiskCacheConfig{
+				Path:               "ftbadge.db",
+				MaxSize:            100 << 20,
+				CompactionInterval: 10 * time.Minute,
+			},
+		},
+		RateLimit: RateLimitConfig{
+			Store:   "memory",
+			Global:  LimiterConfig{Rate: 20, Burst: 30, ExpiresIn: 3 * time.Minute},
+			Profile: LimiterConfig{Rate: 1, Burst: 5, ExpiresIn: 3 * time.Minute},
+			Login:   LimiterConfig{Rate: 0.1, Burst: 20, ExpiresIn: 10 * time.Minute},
+		},
+		APIKeys: APIKeyConfig{
+			Header:        "X-API-Key",
+			QueryParam:    "api_key",
+			Limit:         LimiterConfig{Rate: 10, Burst: 50, ExpiresIn: 3 * time.Minute},
+			DailyQuota:    100000,
+			FlushInterval: 10 * time.Second,
+		},
+		State: StateConfig{
+			Store: "bolt",
+			Path:  "state.db",
+		},
+		Admin: AdminConfig{
+			RefreshInterval: 10 * time.Second,
+		},
+		Auth: AuthConfig{
+			SessionTTL:    24 * time.Hour,
+			SecureCookies: true,
+		},
+		Warmup: WarmupConfig{
+			Interval:        5 * time.Minute,
+			Margin:          time.Hour,
+			RequestInterval: 5 * time.Second,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			ServiceName: "ftbadge",
+			SampleRatio: 1,
+		},
+	}
+}
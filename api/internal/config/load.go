@@ -0,0 +1,218 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-playground/validator/v10"
+	"gopkg.in/yaml.v3"
+)
+
+type field struct {
+	key   string
+	env   string
+	value reflect.Value
+}
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+// fields lists every leaf setting of cfg with its dotted file key, used as
+// flag name, and its environment variable.
+func fields(cfg *Config) []field {
+	var result []field
+
+	var walk func(value reflect.Value, keyPrefix string, envPrefix string)
+	walk = func(value reflect.Value, keyPrefix string, envPrefix string) {
+		for index := range value.NumField() {
+			structField := value.Type().Field(index)
+			key := keyPrefix + structField.Tag.Get("yaml")
+			env := structField.Tag.Get("env")
+			if envPrefix != "" && env != "" {
+				env = envPrefix + "_" + env
+			}
+
+			fieldValue := value.Field(index)
+			if fieldValue.Kind() == reflect.Struct {
+				walk(fieldValue, key+".", env)
+				continue
+			}
+			result = append(result, field{key, env, fieldValue})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "", "")
+
+	return result
+}
+
+func setField(value reflect.Value, raw string) error {
+	if value.Type() == durationType {
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(duration))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		value.SetInt(parsed)
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(parsed)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		value.SetBool(parsed)
+	case reflect.Slice:
+		var items []string
+		for item := range strings.SplitSeq(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", value.Type())
+	}
+	return nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path) // #nosec G304 -- path is provided by the operator
+	if err != nil {
+		return fmt.Errorf("failed to read config file %q: %w", path, err)
+	}
+
+	switch extension := filepath.Ext(path); extension {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to parse YAML config file %q: %w", path, err)
+		}
+	case ".toml":
+		metadata, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("failed to parse TOML config file %q: %w", path, err)
+		}
+		if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("unknown settings %q in config file %q", undecoded, path)
+		}
+	default:
+		return fmt.Errorf("unsupported config file extension %q", extension)
+	}
+	return nil
+}
+
+// Load builds the configuration from defaults, then an optional YAML or TOML
+// file, then environment variables and finally command line flags, each
+// source overriding the previous one. The result is validated before being
+// returned.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	cfg := Default()
+	settings := fields(cfg)
+
+	flagSet := flag.NewFlagSet("ftbadge", flag.ContinueOnError)
+	configPath := flagSet.String("config", getenv("CONFIG_FILE"), "path to a YAML or TOML config file")
+
+	flagValues := make(map[string]string)
+	for _, setting := range settings {
+		usage := "override the " + setting.key + " setting"
+		if setting.env != "" {
+			usage += " (env " + setting.env + ")"
+		}
+		flagSet.Func(setting.key, usage, func(raw string) error {
+			flagValues[setting.key] = raw
+			return nil
+		})
+	}
+	if err := flagSet.Parse(args); err != nil {
+		return nil, fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	if *configPath != "" {
+		if err := loadFile(cfg, *configPath); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, setting := range settings {
+		if setting.env == "" {
+			continue
+		}
+		if raw := getenv(setting.env); raw != "" {
+			if err := setField(setting.value, raw); err != nil {
+				return nil, fmt.Errorf("invalid value for environment variable %q: %w", setting.env, err)
+			}
+		}
+	}
+
+	for _, setting := range settings {
+		if raw, exists := flagValues[setting.key]; exists {
+			if err := setField(setting.value, raw); err != nil {
+				return nil, fmt.Errorf("invalid value for flag -%s: %w", setting.key, err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) Validate() error {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(func(structField reflect.StructField) string {
+		return structField.Tag.Get("yaml")
+	})
+
+	err := validate.Struct(cfg)
+	if err == nil {
+		if cfg.RateLimit.Store == "redis" && cfg.Cache.Backend != "redis" {
+			return fmt.Errorf("invalid configuration: rate_limit.store redis requires cache.backend redis")
+		}
+		if cfg.State.Store == "redis" && cfg.Cache.Backend != "redis" {
+			return fmt.Errorf("invalid configuration: state.store redis requires cache.backend redis")
+		}
+		return nil
+	}
+
+	validationErrors, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return fmt.Errorf("failed to validate configuration: %w", err)
+	}
+
+	messages := make([]string, len(validationErrors))
+	for index, fieldError := range validationErrors {
+		field := strings.TrimPrefix(fieldError.Namespace(), "Config.")
+		if fieldError.Param() != "" {
+			messages[index] = fmt.Sprintf("%s must satisfy %s=%s", field, fieldError.Tag(), fieldError.Param())
+		} else {
+			messages[index] = fmt.Sprintf("%s must satisfy %s", field, fieldError.Tag())
+		}
+	}
+	return fmt.Errorf("invalid configuration: %s", strings.Join(messages, ", "))
+}
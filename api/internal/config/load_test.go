@@ -0,0 +1,129 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func requiredEnv(overrides map[string]string) func(string) string {
+	env := map[string]string{
+		"SENTRY_DSN":       "https://public@sentry.example.com/1",
+		"FT_CLIENT_ID":     "client_id",
+		"FT_CLIENT_SECRET": "client_secret",
+	}
+	for key, value := range overrides {
+		env[key] = value
+	}
+	return func(key string) string { return env[key] }
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(nil, requiredEnv(nil))
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	if cfg.Port != "3000" || cfg.Cache.Backend != "local" || cfg.RateLimit.Profile.Burst != 5 {
+		t.Fatalf("Unexpected defaults: %+v", cfg)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlPath := writeFile(t, "ftbadge.yaml", `
+port: "4000"
+cache:
+  backend: disk
+  disk:
+    compaction_interval: 1m
+rate_limit:
+  profile:
+    rate: 2
+warmup:
+  logins: [alice, bob]
+`)
+	getenv := requiredEnv(map[string]string{
+		"CONFIG_FILE":             yamlPath,
+		"PORT":                    "5000",
+		"RATE_LIMIT_PROFILE_RATE": "3",
+	})
+
+	cfg, err := Load([]string{"-port", "6000"}, getenv)
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	if cfg.Port != "6000" {
+		t.Fatalf("Expected flag to override env and file, got port %q", cfg.Port)
+	}
+	if cfg.RateLimit.Profile.Rate != 3 {
+		t.Fatalf("Expected env to override file, got rate %v", cfg.RateLimit.Profile.Rate)
+	}
+	if cfg.Cache.Backend != "disk" || cfg.Cache.Disk.CompactionInterval != time.Minute {
+		t.Fatalf("Expected file values to be applied, got %+v", cfg.Cache)
+	}
+	if strings.Join(cfg.Warmup.Logins, ",") != "alice,bob" {
+		t.Fatalf("Expected warm-up logins from file, got %v", cfg.Warmup.Logins)
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	tomlPath := writeFile(t, "ftbadge.toml", `
+[intra]
+timeout = "3s"
+`)
+
+	cfg, err := Load([]string{"-config", tomlPath, "-warmup.logins", "alice, bob"}, requiredEnv(nil))
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	if cfg.Intra.Timeout != 3*time.Second {
+		t.Fatalf("Expected timeout from TOML file, got %v", cfg.Intra.Timeout)
+	}
+	if len(cfg.Warmup.Logins) != 2 || cfg.Warmup.Logins[1] != "bob" {
+		t.Fatalf("Expected comma separated logins from flag, got %v", cfg.Warmup.Logins)
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		getenv   func(string) string
+		expected string
+	}{
+		{"missing credentials", func(string) string { return "" }, "intra.client_id"},
+		{"redis without url", requiredEnv(map[string]string{"CACHE_BACKEND": "redis"}), "cache.redis_url"},
+		{"unknown backend", requiredEnv(map[string]string{"CACHE_BACKEND": "memcached"}), "cache.backend"},
+		{"invalid duration", requiredEnv(map[string]string{"FT_TIMEOUT": "soon"}), "FT_TIMEOUT"},
+		{"invalid sample ratio", requiredEnv(map[string]string{"TRACING_SAMPLE_RATIO": "2"}), "tracing.sample_ratio"},
+		{"rate limits without redis", requiredEnv(map[string]string{"RATE_LIMIT_STORE": "redis"}), "rate_limit.store"},
+		{"state without redis", requiredEnv(map[string]string{"STATE_STORE": "redis"}), "state.store"},
+		{"metrics on the API port", requiredEnv(map[string]string{"METRICS_PORT": "3000"}), "metrics_port"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Load(nil, test.getenv)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Fatalf("Expected error mentioning %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsUnknownFileSettings(t *testing.T) {
+	yamlPath := writeFile(t, "ftbadge.yml", "cache:\n  backnd: redis\n")
+	if _, err := Load([]string{"-config", yamlPath}, requiredEnv(nil)); err == nil {
+		t.Fatal("Expected error for unknown setting")
+	}
+}
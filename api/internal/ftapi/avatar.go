@@ -3,25 +3,77 @@ package ftapi
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"ftbadge/internal/cache"
+	"ftbadge/internal/tracing"
 	"ftbadge/internal/utils"
 )
 
 const (
 	jpegQuality = 70
+	// FallbackAvatarTTL is short so that the real avatar is retried soon
+	FallbackAvatarTTL = time.Hour
 )
 
-func (c *Client) GetAvatar(ctx context.Context, cm *cache.CacheManager, endpoint string) (string, error) {
+// Fallback avatars are PNG while fetched ones are JPEG, which tells them apart
+// once cached.
+const fallbackAvatarMimeType = "image/png"
+
+func IsFallbackAvatar(avatar string) bool {
+	return strings.HasPrefix(avatar, "data:"+fallbackAvatarMimeType+";")
+}
+
+// GetAvatar returns the avatar at avatarURL, or an identicon generated from
+// login when the user has no image or it cannot be fetched.
+func (c *Client) GetAvatar(ctx context.Context, cm *cache.CacheManager, login string, avatarURL string) (string, error) {
+	ctx, span := tracing.Start(ctx, "ftapi.GetAvatar", attribute.String("avatar.url", avatarURL))
+	avatar, err := c.getAvatar(ctx, cm, login, avatarURL)
+	tracing.End(span, err)
+	return avatar, err
+}
+
+func (c *Client) getAvatar(ctx context.Context, cm *cache.CacheManager, login string, avatarURL string) (string, error) {
 	if cachedValue, isCached := cm.Get(cache.CacheKeyAvatar); isCached {
 		return cachedValue, nil
 	}
 
-	image, err := c.fetchAndDecodeImage(ctx, endpoint)
+	if avatarURL == "" {
+		return c.getFallbackAvatar(cm, login)
+	}
+	avatar, err := c.fetchAvatar(ctx, avatarURL)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", err
+		}
+		trace.SpanFromContext(ctx).RecordError(err)
+		return c.getFallbackAvatar(cm, login)
+	}
+
+	if err := cm.Set(cache.CacheKeyAvatar, avatar); err != nil {
+		return "", fmt.Errorf("failed to cache avatar: %w", err)
+	}
+
+	return avatar, nil
+}
+
+func (c *Client) fetchAvatar(ctx context.Context, avatarURL string) (string, error) {
+	parsedURL, err := url.Parse(avatarURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse avatar URL: %w", err)
+	}
+	endpoint := parsedURL.Path
+
+	image, err := c.fetchAndDecodeImage(ctx, parsedURL)
 	if err != nil {
 		return "", fmt.Errorf("failed to fetch and decode avatar: %w", err)
 	}
-	image = utils.CropToSquare(image)
+	image = utils.ResizeSquare(image, cache.AvatarSize)
 
 	jpegData, err := utils.EncodeToJPEG(image, jpegQuality)
 	if err != nil {
@@ -32,10 +84,18 @@ func (c *Client) GetAvatar(ctx context.Context, cm *cache.CacheManager, endpoint
 	if err != nil {
 		return "", fmt.Errorf("failed to convert JPEG bytes to base64 data URI from endpoint %q: %w", endpoint, err)
 	}
+	return base64Image, nil
+}
 
-	if err := cm.Set(cache.CacheKeyAvatar, base64Image); err != nil {
-		return "", fmt.Errorf("failed to cache avatar: %w", err)
+func (c *Client) getFallbackAvatar(cm *cache.CacheManager, login string) (string, error) {
+	pngData, err := utils.EncodeToPNG(utils.Identicon(login, cache.AvatarSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to encode fallback avatar: %w", err)
 	}
+	avatar := utils.BytesToDataURI(fallbackAvatarMimeType, pngData)
 
-	return base64Image, nil
+	if err := cm.SetWithTTL(cache.CacheKeyAvatar, avatar, FallbackAvatarTTL); err != nil {
+		return "", fmt.Errorf("failed to cache fallback avatar: %w", err)
+	}
+	return avatar, nil
 }
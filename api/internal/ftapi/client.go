@@ -7,49 +7,115 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	_ "image/gif"
-	_ "image/jpeg"
-	_ "image/png"
+	"ftbadge/internal/config"
+	"ftbadge/internal/metrics"
+	"ftbadge/internal/reporting"
 )
 
 type Client struct {
-	client     *http.Client
-	apiBaseURL string
-	cdnBaseURL string
+	client       *http.Client
+	apiBaseURL   string
+	cdnBaseURL   string
+	clientID     string
+	clientSecret string
+	quota        atomic.Pointer[Quota]
+
+	avatarHosts        map[string]bool
+	avatarAllowHTTP    bool
+	avatarMaxBytes     int64
+	avatarMaxDimension int
 }
 
-func NewClient(apiBaseURL string, cdnBaseURL string) *Client {
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+type StatusError struct {
+	Endpoint   string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected response status from %s endpoint: %s", e.Endpoint, e.Status)
+}
+
+func NewClient(cfg config.IntraConfig) *Client {
+	c := &Client{
+		apiBaseURL:         cfg.APIBaseURL,
+		cdnBaseURL:         cfg.CDNBaseURL,
+		clientID:           cfg.ClientID,
+		clientSecret:       cfg.ClientSecret,
+		avatarHosts:        avatarHosts(cfg.CDNBaseURL, cfg.AvatarHosts),
+		avatarAllowHTTP:    strings.HasPrefix(strings.ToLower(cfg.CDNBaseURL), "http:"),
+		avatarMaxBytes:     cfg.AvatarMaxBytes,
+		avatarMaxDimension: cfg.AvatarMaxDimension,
+	}
+	c.client = &http.Client{
+		Timeout:       cfg.Timeout,
+		CheckRedirect: c.checkRedirect,
 	}
-	return &Client{client, apiBaseURL, cdnBaseURL}
+	return c
 }
 
-func (c *Client) fetchAndDecodeImage(ctx context.Context, endpoint string) (image.Image, error) {
-	fullURL, err := url.JoinPath(c.cdnBaseURL, endpoint)
+// requestsPerRender is the most requests a profile render makes: the access
+// token, the user and the avatar.
+const requestsPerRender = 3
+
+// RenderTimeout is the longest the Intra requests of a profile render can
+// take together.
+func (c *Client) RenderTimeout() time.Duration {
+	return requestsPerRender * c.client.Timeout
+}
+
+func (c *Client) do(req *http.Request, operation string) (*http.Response, error) {
+	start := time.Now()
+	// #nosec G704 -- safe because host is locked to base URLs or allow-listed avatar hosts
+	resp, err := c.client.Do(req)
+	metrics.IntraRequestDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+
 	if err != nil {
-		return nil, fmt.Errorf("failed to construct URL from base %q and endpoint %q: %w", c.cdnBaseURL, endpoint, err)
+		metrics.IntraRequests.WithLabelValues(operation, "error").Inc()
+		reporting.AddBreadcrumb(req.Context(), "intra", fmt.Sprintf("%s: %v", operation, err))
+		return nil, err
+	}
+	metrics.IntraRequests.WithLabelValues(operation, metrics.StatusLabel(resp.StatusCode)).Inc()
+	reporting.AddBreadcrumb(req.Context(), "intra", fmt.Sprintf("%s: %s", operation, resp.Status))
+	if quota, ok := parseQuota(resp.Header); ok {
+		c.quota.Store(quota)
 	}
+	return resp, nil
+}
+
+func (c *Client) fetchAndDecodeImage(ctx context.Context, imageURL *url.URL) (image.Image, error) {
+	if !c.isAvatarHost(imageURL) {
+		return nil, fmt.Errorf("image URL %q is not on an allowed host", imageURL.Redacted())
+	}
+	fullURL := imageURL.String()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fullURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create HTTP GET request for URL %q: %w", fullURL, err)
 	}
 
-	// #nosec G704 -- safe because host is locked to base URL and path is controlled by application
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req, "avatar")
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute HTTP GET request for URL %q: %w", fullURL, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("received unexpected HTTP status code %d (%s) for URL %q", resp.StatusCode, resp.Status, fullURL)
+		return nil, fmt.Errorf("failed to fetch image from URL %q: %w", fullURL, &StatusError{Endpoint: "avatar", StatusCode: resp.StatusCode, Status: resp.Status})
+	}
+	if resp.ContentLength > c.avatarMaxBytes {
+		return nil, fmt.Errorf("image from URL %q is %d bytes: %w", fullURL, resp.ContentLength, errImageTooLarge)
 	}
 
-	img, _, err := image.Decode(resp.Body)
+	data, err := readLimited(resp.Body, c.avatarMaxBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image from URL %q: %w", fullURL, err)
+	}
+
+	img, err := decodeImage(data, c.avatarMaxDimension)
 	if err != nil {
 		return nil, fmt.Errorf("error decoding image from response body for URL %q: %w", fullURL, err)
 	}
@@ -57,7 +123,7 @@ func (c *Client) fetchAndDecodeImage(ctx context.Context, endpoint string) (imag
 	return img, nil
 }
 
-func (c *Client) get(ctx context.Context, endpoint string, headers http.Header) (*http.Response, error) {
+func (c *Client) get(ctx context.Context, operation string, endpoint string, headers http.Header) (*http.Response, error) {
 	fullURL, err := url.JoinPath(c.apiBaseURL, endpoint)
 	if err != nil {
 		return nil, fmt.Errorf("failed to construct URL from base %q and endpoint %q: %w", c.apiBaseURL, endpoint, err)
@@ -74,8 +140,7 @@ func (c *Client) get(ctx context.Context, endpoint string, headers http.Header)
 		}
 	}
 
-	// #nosec G704 -- safe because host is locked to base URL and path is controlled by application
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req, operation)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute HTTP GET request for URL %q: %w", fullURL, err)
 	}
@@ -83,7 +148,7 @@ func (c *Client) get(ctx context.Context, endpoint string, headers http.Header)
 	return resp, nil
 }
 
-func (c *Client) postForm(ctx context.Context, endpoint string, headers http.Header, data url.Values) (*http.Response, error) {
+func (c *Client) postForm(ctx context.Context, operation string, endpoint string, headers http.Header, data url.Values) (*http.Response, error) {
 	fullURL, err := url.JoinPath(c.apiBaseURL, endpoint)
 	if err != nil {
 		return nil, fmt.Errorf("failed to construct URL from base %q and endpoint %q: %w", c.apiBaseURL, endpoint, err)
@@ -102,8 +167,7 @@ func (c *Client) postForm(ctx context.Context, endpoint string, headers http.Hea
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	// #nosec G704 -- safe because host is locked to base URL and path is controlled by application
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req, operation)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute HTTP POST request for URL %q: %w", fullURL, err)
 	}
@@ -0,0 +1,99 @@
+package ftapi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+const maxRedirects = 10
+
+// Only formats with a registered decoder are accepted, whatever the CDN
+// claims in the Content-Type header.
+var imageMimeTypes = map[string]bool{
+	"image/gif":  true,
+	"image/jpeg": true,
+	"image/png":  true,
+}
+
+var errImageTooLarge = errors.New("image exceeds the configured limits")
+
+func avatarHosts(cdnBaseURL string, hosts []string) map[string]bool {
+	allowed := make(map[string]bool, len(hosts)+1)
+	if cdnURL, err := url.Parse(cdnBaseURL); err == nil {
+		allowed[strings.ToLower(cdnURL.Hostname())] = true
+	}
+	for _, host := range hosts {
+		allowed[strings.ToLower(host)] = true
+	}
+	return allowed
+}
+
+// isAvatarHost only accepts https, unless the CDN base URL itself uses http,
+// so that an Intra URL or a redirect cannot move the download off TLS.
+func (c *Client) isAvatarHost(u *url.URL) bool {
+	secure := u.Scheme == "https" || (c.avatarAllowHTTP && u.Scheme == "http")
+	return secure && c.avatarHosts[strings.ToLower(u.Hostname())]
+}
+
+// checkRedirect keeps redirects on the original host or an avatar host, so
+// that the avatar allow-list cannot be bypassed by the CDN, and never leaves
+// https.
+func (c *Client) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if via[0].URL.Scheme == "https" && req.URL.Scheme != "https" {
+		return fmt.Errorf("redirect to scheme %q is not allowed", req.URL.Scheme)
+	}
+	if req.URL.Host != via[0].URL.Host && !c.isAvatarHost(req.URL) {
+		return fmt.Errorf("redirect to host %q is not allowed", req.URL.Host)
+	}
+	return nil
+}
+
+// readLimited reads r entirely, failing once more than maxBytes are read.
+func readLimited(r io.Reader, maxBytes int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("%w: more than %d bytes", errImageTooLarge, maxBytes)
+	}
+	return data, nil
+}
+
+// decodeImage sniffs the format of data and checks the dimensions from its
+// header before decoding it, so that a small file cannot allocate a huge image.
+func decodeImage(data []byte, maxDimension int) (image.Image, error) {
+	if mimeType := http.DetectContentType(data); !imageMimeTypes[mimeType] {
+		return nil, fmt.Errorf("unsupported image type %q", mimeType)
+	}
+
+	imageConfig, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image header: %w", err)
+	}
+	if imageConfig.Width <= 0 || imageConfig.Height <= 0 {
+		return nil, fmt.Errorf("invalid image dimensions %dx%d", imageConfig.Width, imageConfig.Height)
+	}
+	if imageConfig.Width > maxDimension || imageConfig.Height > maxDimension {
+		return nil, fmt.Errorf("%w: %dx%d pixels", errImageTooLarge, imageConfig.Width, imageConfig.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, nil
+}
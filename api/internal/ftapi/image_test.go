@@ -0,0 +1,232 @@
+package ftapi
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ftbadge/internal/config"
+)
+
+const testMaxDimension = 64
+
+func encodeTestImage(t testing.TB, format string, width int, height int) []byte {
+	t.Helper()
+	img := image.NewPaletted(image.Rect(0, 0, width, height), []color.Color{color.Black, color.White})
+	for x := range width {
+		img.SetColorIndex(x, x%height, 1)
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatalf("Failed to encode %s image: %v", format, err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeImage(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		tooLarge bool
+		valid    bool
+	}{
+		{"png", encodeTestImage(t, "png", 32, 16), false, true},
+		{"jpeg", encodeTestImage(t, "jpeg", 16, 32), false, true},
+		{"gif", encodeTestImage(t, "gif", 64, 64), false, true},
+		{"too wide", encodeTestImage(t, "png", testMaxDimension+1, 1), true, false},
+		{"too tall", encodeTestImage(t, "gif", 1, testMaxDimension+1), true, false},
+		{"html", []byte("<html><body>not an image</body></html>"), false, false},
+		{"truncated", encodeTestImage(t, "png", 32, 32)[:60], false, false},
+		{"empty", nil, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := decodeImage(test.data, testMaxDimension)
+			if !test.valid {
+				if err == nil {
+					t.Fatal("Expected the image to be rejected")
+				}
+				if tooLarge := errors.Is(err, errImageTooLarge); tooLarge != test.tooLarge {
+					t.Fatalf("Expected too large to be %v, got %v", test.tooLarge, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to decode image: %v", err)
+			}
+			if bounds := img.Bounds(); bounds.Dx() > testMaxDimension || bounds.Dy() > testMaxDimension {
+				t.Fatalf("Unexpected image bounds %v", bounds)
+			}
+		})
+	}
+}
+
+func TestReadLimited(t *testing.T) {
+	data, err := readLimited(strings.NewReader("12345"), 5)
+	if err != nil || string(data) != "12345" {
+		t.Fatalf("Expected the body to be read, got %q: %v", data, err)
+	}
+	if _, err := readLimited(strings.NewReader("123456"), 5); !errors.Is(err, errImageTooLarge) {
+		t.Fatalf("Expected an oversized body to be rejected, got %v", err)
+	}
+}
+
+func TestFetchAndDecodeImage(t *testing.T) {
+	pngData := encodeTestImage(t, "png", 32, 32)
+	var externalCalls atomic.Int32
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		externalCalls.Add(1)
+		w.Write(pngData)
+	}))
+	defer external.Close()
+	externalURL, err := url.Parse(external.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse external URL: %v", err)
+	}
+	// Same server under a host that is not allowed
+	externalURL.Host = "localhost:" + externalURL.Port()
+
+	cdnMux := http.NewServeMux()
+	cdnMux.HandleFunc("/avatar.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(pngData)
+	})
+	cdnMux.HandleFunc("/large.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(encodeTestImage(t, "png", testMaxDimension*2, testMaxDimension*2))
+	})
+	cdnMux.HandleFunc("/page.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("<!DOCTYPE html><html></html>"))
+	})
+	cdnMux.HandleFunc("/redirect.png", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, externalURL.String()+"/avatar.png", http.StatusFound)
+	})
+	cdn := httptest.NewServer(cdnMux)
+	defer cdn.Close()
+
+	c := NewClient(config.IntraConfig{
+		CDNBaseURL:         cdn.URL,
+		Timeout:            10 * time.Second,
+		AvatarMaxBytes:     int64(len(pngData)) * 2,
+		AvatarMaxDimension: testMaxDimension,
+	})
+
+	tests := []struct {
+		name  string
+		url   string
+		valid bool
+	}{
+		{"allowed host", cdn.URL + "/avatar.png", true},
+		{"too large", cdn.URL + "/large.png", false},
+		{"not an image", cdn.URL + "/page.html", false},
+		{"other host", externalURL.String() + "/avatar.png", false},
+		{"redirect to other host", cdn.URL + "/redirect.png", false},
+		{"other scheme", "file:///etc/passwd", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			imageURL, err := url.Parse(test.url)
+			if err != nil {
+				t.Fatalf("Failed to parse URL: %v", err)
+			}
+			_, err = c.fetchAndDecodeImage(t.Context(), imageURL)
+			if test.valid && err != nil {
+				t.Fatalf("Failed to fetch image: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("Expected the image to be rejected")
+			}
+		})
+	}
+
+	if calls := externalCalls.Load(); calls != 0 {
+		t.Fatalf("Expected hosts outside the allow-list not to be requested, got %d calls", calls)
+	}
+}
+
+func TestAvatarScheme(t *testing.T) {
+	tests := []struct {
+		name     string
+		cdn      string
+		url      string
+		redirect string
+		valid    bool
+	}{
+		{"https", "https://cdn.intra.42.fr", "https://cdn.intra.42.fr/avatar.png", "", true},
+		{"http on an https cdn", "https://cdn.intra.42.fr", "http://cdn.intra.42.fr/avatar.png", "", false},
+		{"http on an http cdn", "http://cdn.intra.42.fr", "http://cdn.intra.42.fr/avatar.png", "", true},
+		{"redirect on https", "https://cdn.intra.42.fr", "https://cdn.intra.42.fr/avatar.png", "https://cdn.intra.42.fr/other.png", true},
+		{"redirect to http", "https://cdn.intra.42.fr", "https://cdn.intra.42.fr/avatar.png", "http://cdn.intra.42.fr/other.png", false},
+		{"redirect to http on an http cdn", "http://cdn.intra.42.fr", "https://cdn.intra.42.fr/avatar.png", "http://cdn.intra.42.fr/other.png", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewClient(config.IntraConfig{CDNBaseURL: test.cdn, Timeout: 10 * time.Second})
+			imageURL, err := url.Parse(test.url)
+			if err != nil {
+				t.Fatalf("Failed to parse URL: %v", err)
+			}
+			if test.redirect == "" {
+				if allowed := c.isAvatarHost(imageURL); allowed != test.valid {
+					t.Fatalf("Expected the avatar URL to be allowed: %v, got %v", test.valid, allowed)
+				}
+				return
+			}
+
+			redirectURL, err := url.Parse(test.redirect)
+			if err != nil {
+				t.Fatalf("Failed to parse redirect URL: %v", err)
+			}
+			err = c.checkRedirect(&http.Request{URL: redirectURL}, []*http.Request{{URL: imageURL}})
+			if test.valid && err != nil {
+				t.Fatalf("Failed to follow redirect: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("Expected the redirect to be rejected")
+			}
+		})
+	}
+}
+
+func FuzzDecodeImage(f *testing.F) {
+	for _, format := range []string{"png", "jpeg", "gif"} {
+		f.Add(encodeTestImage(f, format, 16, 16))
+		f.Add(encodeTestImage(f, format, testMaxDimension+1, 2))
+	}
+	f.Add([]byte("GIF89a"))
+	f.Add([]byte("\x89PNG\r\n\x1a\n"))
+	f.Add([]byte("\xff\xd8\xff"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		img, err := decodeImage(data, testMaxDimension)
+		if err != nil {
+			return
+		}
+		if bounds := img.Bounds(); bounds.Dx() > testMaxDimension || bounds.Dy() > testMaxDimension {
+			t.Fatalf("Decoded image %v exceeds the dimension limit", bounds)
+		}
+	})
+}
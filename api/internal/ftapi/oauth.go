@@ -9,7 +9,8 @@ import (
 	"time"
 
 	"ftbadge/internal/cache"
-	"ftbadge/internal/utils"
+	"ftbadge/internal/metrics"
+	"ftbadge/internal/tracing"
 )
 
 type oauthTokenResponse struct {
@@ -23,26 +24,30 @@ const (
 )
 
 func (c *Client) GetAccessToken(ctx context.Context, cm *cache.CacheManager) (string, error) {
+	ctx, span := tracing.Start(ctx, "ftapi.GetAccessToken")
+	accessToken, err := c.getAccessToken(ctx, cm)
+	tracing.End(span, err)
+	return accessToken, err
+}
+
+func (c *Client) getAccessToken(ctx context.Context, cm *cache.CacheManager) (string, error) {
 	if cachedValue, isCached := cm.Get(cache.CacheKeyAccessToken); isCached {
 		return cachedValue, nil
 	}
 
-	clientID := utils.MustGetEnv("FT_CLIENT_ID")
-	clientSecret := utils.MustGetEnv("FT_CLIENT_SECRET")
-
 	data := url.Values{}
 	data.Set("grant_type", grantType)
-	data.Set("client_id", clientID)
-	data.Set("client_secret", clientSecret)
+	data.Set("client_id", c.clientID)
+	data.Set("client_secret", c.clientSecret)
 
-	resp, err := c.postForm(ctx, "/oauth/token", nil, data)
+	resp, err := c.postForm(ctx, "token", "/oauth/token", nil, data)
 	if err != nil {
 		return "", fmt.Errorf("failed to send token request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected response status from token endpoint: %d %s", resp.StatusCode, resp.Status)
+		return "", &StatusError{Endpoint: "token", StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	var tokenResp oauthTokenResponse
@@ -50,6 +55,8 @@ func (c *Client) GetAccessToken(ctx context.Context, cm *cache.CacheManager) (st
 		return "", fmt.Errorf("failed to decode token response from token endpoint: %w", err)
 	}
 
+	metrics.TokenRefreshes.Inc()
+
 	accessToken := tokenResp.AccessToken
 	ttl := time.Duration(tokenResp.ExpiresIn) * time.Second
 	if err := cm.SetWithTTL(cache.CacheKeyAccessToken, accessToken, ttl); err != nil {
@@ -58,3 +65,54 @@ func (c *Client) GetAccessToken(ctx context.Context, cm *cache.CacheManager) (st
 
 	return accessToken, nil
 }
+
+// AuthorizeURL returns the Intra page where a student grants access to their
+// account, which then redirects to redirectURL with a code and state.
+func (c *Client) AuthorizeURL(redirectURL string, state string) (string, error) {
+	authorizeURL, err := url.JoinPath(c.apiBaseURL, "/oauth/authorize")
+	if err != nil {
+		return "", fmt.Errorf("failed to construct authorize URL from base %q: %w", c.apiBaseURL, err)
+	}
+
+	query := url.Values{}
+	query.Set("client_id", c.clientID)
+	query.Set("redirect_uri", redirectURL)
+	query.Set("response_type", "code")
+	query.Set("scope", "public")
+	query.Set("state", state)
+	return authorizeURL + "?" + query.Encode(), nil
+}
+
+// ExchangeCode trades an authorization code for an access token of the
+// student. The token is not cached since it is only used once.
+func (c *Client) ExchangeCode(ctx context.Context, code string, redirectURL string) (string, error) {
+	ctx, span := tracing.Start(ctx, "ftapi.ExchangeCode")
+	accessToken, err := c.exchangeCode(ctx, code, redirectURL)
+	tracing.End(span, err)
+	return accessToken, err
+}
+
+func (c *Client) exchangeCode(ctx context.Context, code string, redirectURL string) (string, error) {
+	data := url.Values{}
+	data.Set("grant_type", "authorization_code")
+	data.Set("client_id", c.clientID)
+	data.Set("client_secret", c.clientSecret)
+	data.Set("code", code)
+	data.Set("redirect_uri", redirectURL)
+
+	resp, err := c.postForm(ctx, "token", "/oauth/token", nil, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to send token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &StatusError{Endpoint: "token", StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	var tokenResp oauthTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", fmt.Errorf("failed to decode token response from token endpoint: %w", err)
+	}
+	return tokenResp.AccessToken, nil
+}
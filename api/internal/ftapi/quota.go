@@ -0,0 +1,45 @@
+package ftapi
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Quota is the Intra application rate limit reported in the headers of the
+// latest API response.
+type Quota struct {
+	HourlyLimit       int       `json:"hourly_limit"`
+	HourlyRemaining   int       `json:"hourly_remaining"`
+	SecondlyLimit     int       `json:"secondly_limit"`
+	SecondlyRemaining int       `json:"secondly_remaining"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+func parseQuota(header http.Header) (*Quota, bool) {
+	values := []string{
+		header.Get("X-Hourly-Ratelimit-Limit"),
+		header.Get("X-Hourly-Ratelimit-Remaining"),
+		header.Get("X-Secondly-Ratelimit-Limit"),
+		header.Get("X-Secondly-Ratelimit-Remaining"),
+	}
+
+	parsed := make([]int, len(values))
+	for index, value := range values {
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, false
+		}
+		parsed[index] = number
+	}
+	return &Quota{parsed[0], parsed[1], parsed[2], parsed[3], time.Now()}, true
+}
+
+// Quota returns false until a response with rate limit headers was received.
+func (c *Client) Quota() (Quota, bool) {
+	quota := c.quota.Load()
+	if quota == nil {
+		return Quota{}, false
+	}
+	return *quota, true
+}
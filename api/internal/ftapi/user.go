@@ -8,7 +8,10 @@ import (
 	"net/http"
 	"net/url"
 
+	"go.opentelemetry.io/otel/attribute"
+
 	"ftbadge/internal/cache"
+	"ftbadge/internal/tracing"
 	"ftbadge/internal/utils"
 )
 
@@ -41,9 +44,9 @@ type User struct {
 }
 
 func createUser(userResp *userResponse) *User {
-	grade := "N/A"
+	// Missing values are labelled when the badge is rendered
+	var grade, cursusName string
 	level := 0.0
-	cursusName := "N/A"
 
 	if len(userResp.CursusUsers) > 0 {
 		cursus := userResp.CursusUsers[len(userResp.CursusUsers)-1]
@@ -64,6 +67,13 @@ func createUser(userResp *userResponse) *User {
 }
 
 func (c *Client) GetUser(ctx context.Context, cm *cache.CacheManager, login string) (*User, error) {
+	ctx, span := tracing.Start(ctx, "ftapi.GetUser", attribute.String("login", login))
+	user, err := c.getUser(ctx, cm, login)
+	tracing.End(span, err)
+	return user, err
+}
+
+func (c *Client) getUser(ctx context.Context, cm *cache.CacheManager, login string) (*User, error) {
 	accessToken, err := c.GetAccessToken(ctx, cm)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve access token: %w", err)
@@ -78,7 +88,7 @@ func (c *Client) GetUser(ctx context.Context, cm *cache.CacheManager, login stri
 		return nil, fmt.Errorf("failed to construct user endpoint: %w", err)
 	}
 
-	resp, err := c.get(ctx, endpoint, headers)
+	resp, err := c.get(ctx, "user", endpoint, headers)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send user request: %w", err)
 	}
@@ -88,7 +98,7 @@ func (c *Client) GetUser(ctx context.Context, cm *cache.CacheManager, login stri
 		return nil, nil
 	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected response status from user endpoint: %d %s", resp.StatusCode, resp.Status)
+		return nil, &StatusError{Endpoint: "user", StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	var data []byte
@@ -114,3 +124,39 @@ func (c *Client) GetUser(ctx context.Context, cm *cache.CacheManager, login stri
 
 	return user, nil
 }
+
+type meResponse struct {
+	Login string `json:"login"`
+}
+
+// GetMe returns the login of the student owning accessToken.
+func (c *Client) GetMe(ctx context.Context, accessToken string) (string, error) {
+	ctx, span := tracing.Start(ctx, "ftapi.GetMe")
+	login, err := c.getMe(ctx, accessToken)
+	tracing.End(span, err)
+	return login, err
+}
+
+func (c *Client) getMe(ctx context.Context, accessToken string) (string, error) {
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := c.get(ctx, "me", "/me", headers)
+	if err != nil {
+		return "", fmt.Errorf("failed to send me request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &StatusError{Endpoint: "me", StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	var meResp meResponse
+	if err := json.NewDecoder(resp.Body).Decode(&meResp); err != nil {
+		return "", fmt.Errorf("failed to decode me response: %w", err)
+	}
+	if meResp.Login == "" {
+		return "", fmt.Errorf("me response does not contain a login")
+	}
+	return meResp.Login, nil
+}
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/rs/zerolog"
+
+	"ftbadge/internal/cache"
+	"ftbadge/internal/ftapi"
+	"ftbadge/internal/state"
+)
+
+const (
+	maintenanceKey = "maintenance"
+	blocklistSet   = "blocklist"
+)
+
+// ServiceState holds the settings changed through the admin API. They are
+// saved in the state store, shared between instances, and read from a
+// snapshot refreshed by Run, so changes made on another instance apply
+// within the refresh interval.
+type ServiceState struct {
+	store       state.Store
+	maintenance atomic.Bool
+
+	mu      sync.RWMutex
+	blocked map[string]struct{}
+}
+
+// NewServiceState adds the blocked logins to the state store, so logins of
+// the configuration are blocked again on restart even if they were unblocked
+// through the admin API.
+func NewServiceState(ctx context.Context, store state.Store, blocked []string) (*ServiceState, error) {
+	for _, login := range blocked {
+		login = strings.ToLower(login)
+		if err := store.AddMember(ctx, blocklistSet, login); err != nil {
+			return nil, fmt.Errorf("failed to block %q: %w", login, err)
+		}
+	}
+
+	serviceState := &ServiceState{store: store}
+	if err := serviceState.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return serviceState, nil
+}
+
+// Refresh reads the settings from the state store.
+func (s *ServiceState) Refresh(ctx context.Context) error {
+	value, _, err := s.store.Get(ctx, maintenanceKey)
+	if err != nil {
+		return fmt.Errorf("failed to get maintenance mode: %w", err)
+	}
+	logins, err := s.store.Members(ctx, blocklistSet)
+	if err != nil {
+		return fmt.Errorf("failed to get blocklist: %w", err)
+	}
+
+	blocked := make(map[string]struct{}, len(logins))
+	for _, login := range logins {
+		blocked[login] = struct{}{}
+	}
+
+	s.maintenance.Store(value == "1")
+	s.mu.Lock()
+	s.blocked = blocked
+	s.mu.Unlock()
+	return nil
+}
+
+// Run refreshes the settings every interval until ctx is done. The previous
+// snapshot is kept when the state store cannot be read.
+func (s *ServiceState) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = s.Refresh(ctx)
+		}
+	}
+}
+
+func (s *ServiceState) Maintenance() bool {
+	return s != nil && s.maintenance.Load()
+}
+
+func (s *ServiceState) SetMaintenance(ctx context.Context, enabled bool) error {
+	value := "0"
+	if enabled {
+		value = "1"
+	}
+	if err := s.store.Set(ctx, maintenanceKey, value); err != nil {
+		return fmt.Errorf("failed to save maintenance mode: %w", err)
+	}
+	s.maintenance.Store(enabled)
+	return nil
+}
+
+func (s *ServiceState) Blocked(login string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, blocked := s.blocked[login]
+	return blocked
+}
+
+func (s *ServiceState) Block(ctx context.Context, login string) error {
+	if err := s.store.AddMember(ctx, blocklistSet, login); err != nil {
+		return fmt.Errorf("failed to block %q: %w", login, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocked[login] = struct{}{}
+	return nil
+}
+
+// Unblock returns false when the login was not blocked.
+func (s *ServiceState) Unblock(ctx context.Context, login string) (bool, error) {
+	unblocked, err := s.store.RemoveMember(ctx, blocklistSet, login)
+	if err != nil {
+		return false, fmt.Errorf("failed to unblock %q: %w", login, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blocked, login)
+	return unblocked, nil
+}
+
+// BlockedLogins reads the blocklist from the state store, so it includes the
+// changes made on other instances since the last refresh.
+func (s *ServiceState) BlockedLogins(ctx context.Context) ([]string, error) {
+	logins, err := s.store.Members(ctx, blocklistSet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blocklist: %w", err)
+	}
+	return logins, nil
+}
+
+type MaintenanceError struct{}
+
+func (e *MaintenanceError) Error() string {
+	return "service is under maintenance"
+}
+
+// AdminAuth only lets requests through with the configured bearer token.
+func AdminAuth(token string) echo.MiddlewareFunc {
+	return middleware.KeyAuthWithConfig(middleware.KeyAuthConfig{
+		KeyLookup:  "header:" + echo.HeaderAuthorization,
+		AuthScheme: "Bearer",
+		Validator: func(key string, ctx echo.Context) (bool, error) {
+			return subtle.ConstantTimeCompare([]byte(key), []byte(token)) == 1, nil
+		},
+	})
+}
+
+// AdminAuditLog logs every admin request, including the ones rejected by
+// AdminAuth when it is registered after this middleware.
+func AdminAuditLog(logger zerolog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			err := next(ctx)
+
+			status := ctx.Response().Status
+			var httpError *echo.HTTPError
+			if err != nil {
+				status = http.StatusInternalServerError
+				if errors.As(err, &httpError) {
+					status = httpError.Code
+				}
+			}
+
+			event := logger.Info()
+			if status >= http.StatusBadRequest {
+				event = logger.Warn()
+			}
+			event.
+				Str("request_id", ctx.Response().Header().Get(echo.HeaderXRequestID)).
+				Str("remote_ip", ctx.RealIP()).
+				Str("method", ctx.Request().Method).
+				Str("action", ctx.Path()).
+				Strs("params", ctx.ParamValues()).
+				Int("status", status).
+				Err(err).
+				Msg("admin action")
+			return err
+		}
+	}
+}
+
+type adminLoginParam struct {
+	Login string `param:"login" validate:"required,alphanum,max=32"`
+}
+
+func bindAdminLogin(ctx echo.Context) (string, error) {
+	param := adminLoginParam{}
+	if err := ctx.Bind(&param); err != nil {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "Invalid parameters").SetInternal(err)
+	}
+	if err := ctx.Validate(param); err != nil {
+		return "", err
+	}
+	return strings.ToLower(param.Login), nil
+}
+
+func purgeLogin(ctx echo.Context, cc cache.CacheClient, login string) error {
+	cm, err := cache.NewCacheManager(ctx.Request().Context(), cc, login)
+	if err != nil {
+		return fmt.Errorf("failed to initialize cache manager: %w", err)
+	}
+	return cm.Purge(ctx.Request().Context(), cache.CacheKeyProfile, cache.CacheKeyProfileFailure, cache.CacheKeyAvatar)
+}
+
+func GetPurgeCacheHandler(cc cache.CacheClient) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		login, err := bindAdminLogin(ctx)
+		if err != nil {
+			return err
+		}
+		if err := purgeLogin(ctx, cc, login); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to purge cache").SetInternal(err)
+		}
+		return ctx.NoContent(http.StatusNoContent)
+	}
+}
+
+func GetCacheStatsHandler(cc cache.CacheClient) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		stats, err := cache.Stats(ctx.Request().Context(), cc)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get cache stats").SetInternal(err)
+		}
+		return ctx.JSON(http.StatusOK, stats)
+	}
+}
+
+func GetIntraQuotaHandler(ftc *ftapi.Client) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		quota, known := ftc.Quota()
+		if !known {
+			return echo.NewHTTPError(http.StatusNotFound, "No Intra quota reported yet")
+		}
+		return ctx.JSON(http.StatusOK, quota)
+	}
+}
+
+type maintenanceRequest struct {
+	Enabled *bool `json:"enabled" validate:"required"`
+}
+
+func GetMaintenanceHandler(serviceState *ServiceState) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		data := map[string]bool{"enabled": serviceState.Maintenance()}
+		return ctx.JSON(http.StatusOK, data)
+	}
+}
+
+func GetSetMaintenanceHandler(serviceState *ServiceState) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		request := maintenanceRequest{}
+		if err := ctx.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid parameters").SetInternal(err)
+		}
+		if err := ctx.Validate(request); err != nil {
+			return err
+		}
+
+		if err := serviceState.SetMaintenance(ctx.Request().Context(), *request.Enabled); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to set maintenance mode").SetInternal(err)
+		}
+		data := map[string]bool{"enabled": *request.Enabled}
+		return ctx.JSON(http.StatusOK, data)
+	}
+}
+
+func GetBlocklistHandler(serviceState *ServiceState) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		logins, err := serviceState.BlockedLogins(ctx.Request().Context())
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get blocklist").SetInternal(err)
+		}
+		return ctx.JSON(http.StatusOK, logins)
+	}
+}
+
+// GetBlockLoginHandler also purges the cached profile and avatar of the login.
+func GetBlockLoginHandler(serviceState *ServiceState, cc cache.CacheClient) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		login, err := bindAdminLogin(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := serviceState.Block(ctx.Request().Context(), login); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to block login").SetInternal(err)
+		}
+		if err := purgeLogin(ctx, cc, login); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to purge cache").SetInternal(err)
+		}
+		return ctx.NoContent(http.StatusNoContent)
+	}
+}
+
+func GetUnblockLoginHandler(serviceState *ServiceState) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		login, err := bindAdminLogin(ctx)
+		if err != nil {
+			return err
+		}
+
+		unblocked, err := serviceState.Unblock(ctx.Request().Context(), login)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to unblock login").SetInternal(err)
+		}
+		if !unblocked {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Login %q is not blocked", login))
+		}
+		return ctx.NoContent(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+
+	"ftbadge/internal/cache/cachetest"
+	"ftbadge/internal/ftvalidator"
+	"ftbadge/internal/state"
+)
+
+func TestAdminRoutes(t *testing.T) {
+	const token = "test_admin_token_0123456789"
+
+	cc := cachetest.NewClient(nil)
+	serviceState, err := NewServiceState(t.Context(), state.NewMemoryStore(), nil)
+	if err != nil {
+		t.Fatalf("Failed to create service state: %v", err)
+	}
+	var logs strings.Builder
+
+	e := echo.New()
+	e.Validator = ftvalidator.New()
+	admin := e.Group("/admin", AdminAuditLog(zerolog.New(&logs)), AdminAuth(token))
+	admin.DELETE("/cache/:login", GetPurgeCacheHandler(cc))
+	admin.PUT("/maintenance", GetSetMaintenanceHandler(serviceState))
+	admin.PUT("/blocklist/:login", GetBlockLoginHandler(serviceState, cc))
+	admin.DELETE("/blocklist/:login", GetUnblockLoginHandler(serviceState))
+
+	request := func(method string, path string, body string, authorization string) int {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if authorization != "" {
+			req.Header.Set(echo.HeaderAuthorization, authorization)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := request(http.MethodPut, "/admin/maintenance", `{"enabled":true}`, "Bearer wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("Expected wrong token to be rejected, got %d", code)
+	}
+	if serviceState.Maintenance() {
+		t.Fatal("Expected maintenance to stay disabled after a rejected request")
+	}
+
+	if code := request(http.MethodPut, "/admin/maintenance", `{"enabled":true}`, "Bearer "+token); code != http.StatusOK {
+		t.Fatalf("Expected maintenance to be enabled, got %d", code)
+	}
+	if !serviceState.Maintenance() {
+		t.Fatal("Expected maintenance to be enabled")
+	}
+
+	if code := request(http.MethodPut, "/admin/blocklist/TestUser", "", "Bearer "+token); code != http.StatusNoContent {
+		t.Fatalf("Expected login to be blocked, got %d", code)
+	}
+	if !serviceState.Blocked("testuser") || cc.CallCount(cachetest.MethodDelete) != 1 {
+		t.Fatal("Expected blocked login to be lowercased and purged from the cache")
+	}
+	if code := request(http.MethodDelete, "/admin/blocklist/testuser", "", "Bearer "+token); code != http.StatusNoContent {
+		t.Fatalf("Expected login to be unblocked, got %d", code)
+	}
+	if code := request(http.MethodDelete, "/admin/blocklist/testuser", "", "Bearer "+token); code != http.StatusNotFound {
+		t.Fatalf("Expected unblocking twice to fail, got %d", code)
+	}
+
+	if code := request(http.MethodDelete, "/admin/cache/testuser", "", "Bearer "+token); code != http.StatusNoContent {
+		t.Fatalf("Expected cache to be purged, got %d", code)
+	}
+	calls := cc.Calls()
+	expectedKeys := []string{"profile:testuser", "profile-failure:testuser", "avatar:testuser:200"}
+	if keys := calls[len(calls)-1].Keys; !slices.Equal(keys, expectedKeys) {
+		t.Fatalf("Expected profile, failure and avatar keys to be purged, got %q", keys)
+	}
+
+	if count := strings.Count(logs.String(), `"message":"admin action"`); count != 6 {
+		t.Fatalf("Expected every admin request to be logged, got %d entries: %s", count, logs.String())
+	}
+}
+
+func TestServiceStateShared(t *testing.T) {
+	store := state.NewMemoryStore()
+	first, err := NewServiceState(t.Context(), store, []string{"Configured"})
+	if err != nil {
+		t.Fatalf("Failed to create service state: %v", err)
+	}
+	second, err := NewServiceState(t.Context(), store, nil)
+	if err != nil {
+		t.Fatalf("Failed to create service state: %v", err)
+	}
+	if !second.Blocked("configured") {
+		t.Fatal("Expected configured logins to be saved in the state store")
+	}
+
+	if err := first.SetMaintenance(t.Context(), true); err != nil {
+		t.Fatalf("Failed to enable maintenance: %v", err)
+	}
+	if err := first.Block(t.Context(), "testuser"); err != nil {
+		t.Fatalf("Failed to block login: %v", err)
+	}
+	if unblocked, err := first.Unblock(t.Context(), "configured"); err != nil || !unblocked {
+		t.Fatalf("Failed to unblock login: %v", err)
+	}
+	if second.Maintenance() || second.Blocked("testuser") {
+		t.Fatal("Expected other instances to apply changes on refresh")
+	}
+
+	if err := second.Refresh(t.Context()); err != nil {
+		t.Fatalf("Failed to refresh service state: %v", err)
+	}
+	if !second.Maintenance() || !second.Blocked("testuser") || second.Blocked("configured") {
+		t.Fatal("Expected other instances to apply changes after a refresh")
+	}
+	if logins, err := second.BlockedLogins(t.Context()); err != nil || len(logins) != 1 || logins[0] != "testuser" {
+		t.Fatalf("Unexpected blocklist: %q, %v", logins, err)
+	}
+
+	// A restart with the same state store keeps the changes
+	restarted, err := NewServiceState(t.Context(), store, nil)
+	if err != nil {
+		t.Fatalf("Failed to create service state: %v", err)
+	}
+	if !restarted.Maintenance() || !restarted.Blocked("testuser") {
+		t.Fatal("Expected changes to survive a restart")
+	}
+}
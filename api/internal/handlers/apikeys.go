@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"ftbadge/internal/apikey"
+	"ftbadge/internal/config"
+	"ftbadge/internal/metrics"
+)
+
+const apiKeyContextKey = "api_key"
+
+func apiKeyFromContext(ctx echo.Context) *apikey.Key {
+	key, _ := ctx.Get(apiKeyContextKey).(*apikey.Key)
+	return key
+}
+
+// APIKeyMiddleware authenticates the API key sent in the configured header or
+// query parameter and records its usage. The header takes precedence, and
+// requests without a key are served anonymously.
+func APIKeyMiddleware(keys *apikey.Manager, cfg config.APIKeyConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			token := ctx.Request().Header.Get(cfg.Header)
+			if token == "" {
+				token = ctx.QueryParam(cfg.QueryParam)
+			}
+			if token == "" {
+				return next(ctx)
+			}
+
+			key, err := keys.Authenticate(ctx.Request().Context(), token)
+			if errors.Is(err, apikey.ErrInvalidKey) {
+				data := map[string]string{"error": "invalid API key"}
+				return ctx.JSON(http.StatusUnauthorized, data)
+			} else if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "Failed to authenticate API key").SetInternal(err)
+			}
+
+			if err := keys.Record(ctx.Request().Context(), key); errors.Is(err, apikey.ErrQuotaExceeded) {
+				metrics.RecordRateLimitRejection(ctx)
+				data := map[string]string{"error": "quota exceeded"}
+				return ctx.JSON(http.StatusTooManyRequests, data)
+			} else if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "Failed to record API key usage").SetInternal(err)
+			}
+
+			ctx.Set(apiKeyContextKey, key)
+			return next(ctx)
+		}
+	}
+}
+
+type apiKeyResponse struct {
+	*apikey.Key
+	// Shadows the stored hash so it is never returned
+	SecretHash string        `json:"secret_hash,omitempty"`
+	Usage      *apikey.Usage `json:"usage,omitempty"`
+}
+
+type issueAPIKeyRequest struct {
+	Name       string  `json:"name" validate:"required,max=64"`
+	Rate       float64 `json:"rate" validate:"gte=0"`
+	Burst      int     `json:"burst" validate:"gte=0"`
+	DailyQuota *int64  `json:"daily_quota" validate:"omitempty,gte=0"`
+}
+
+type apiKeyParam struct {
+	ID string `param:"id" validate:"required,hexadecimal"`
+}
+
+func GetIssueAPIKeyHandler(keys *apikey.Manager) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		request := issueAPIKeyRequest{}
+		if err := ctx.Bind(&request); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid parameters").SetInternal(err)
+		}
+		if err := ctx.Validate(request); err != nil {
+			return err
+		}
+
+		token, key, err := keys.Issue(ctx.Request().Context(), apikey.IssueOptions{
+			Name:       request.Name,
+			Rate:       request.Rate,
+			Burst:      request.Burst,
+			DailyQuota: request.DailyQuota,
+		})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to issue API key").SetInternal(err)
+		}
+
+		data := map[string]any{"token": token, "key": apiKeyResponse{Key: key}}
+		return ctx.JSON(http.StatusCreated, data)
+	}
+}
+
+func GetListAPIKeysHandler(keys *apikey.Manager) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		list, err := keys.List(ctx.Request().Context())
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to list API keys").SetInternal(err)
+		}
+
+		data := make([]apiKeyResponse, len(list))
+		for index, key := range list {
+			usage, err := keys.Usage(ctx.Request().Context(), key.ID)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get API key usage").SetInternal(err)
+			}
+			data[index] = apiKeyResponse{Key: key, Usage: &usage}
+		}
+		return ctx.JSON(http.StatusOK, data)
+	}
+}
+
+func GetAPIKeyHandler(keys *apikey.Manager) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		param := apiKeyParam{}
+		if err := ctx.Bind(&param); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid parameters").SetInternal(err)
+		}
+		if err := ctx.Validate(param); err != nil {
+			return err
+		}
+
+		key, err := keys.Get(ctx.Request().Context(), param.ID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get API key").SetInternal(err)
+		}
+		if key == nil {
+			return echo.NewHTTPError(http.StatusNotFound, "API key not found")
+		}
+		usage, err := keys.Usage(ctx.Request().Context(), key.ID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get API key usage").SetInternal(err)
+		}
+		return ctx.JSON(http.StatusOK, apiKeyResponse{Key: key, Usage: &usage})
+	}
+}
+
+func GetRevokeAPIKeyHandler(keys *apikey.Manager) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		param := apiKeyParam{}
+		if err := ctx.Bind(&param); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid parameters").SetInternal(err)
+		}
+		if err := ctx.Validate(param); err != nil {
+			return err
+		}
+
+		revoked, err := keys.Revoke(ctx.Request().Context(), param.ID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to revoke API key").SetInternal(err)
+		}
+		if !revoked {
+			return echo.NewHTTPError(http.StatusNotFound, "API key not found")
+		}
+		return ctx.NoContent(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/time/rate"
+
+	"ftbadge/internal/apikey"
+	"ftbadge/internal/config"
+	"ftbadge/internal/ftvalidator"
+	"ftbadge/internal/state"
+)
+
+func newTestAPIKeys(t *testing.T) (*apikey.Manager, config.APIKeyConfig) {
+	t.Helper()
+
+	cfg := config.Default().APIKeys
+	return apikey.NewManager(apikey.NewStore(state.NewMemoryStore()), cfg, func(name string, limiter config.LimiterConfig) (middleware.RateLimiterStore, error) {
+		return middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{Rate: rate.Limit(limiter.Rate), Burst: limiter.Burst}), nil
+	}), cfg
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	keys, cfg := newTestAPIKeys(t)
+	quota := int64(3)
+	token, _, err := keys.Issue(t.Context(), apikey.IssueOptions{Name: "dashboard", DailyQuota: &quota})
+	if err != nil {
+		t.Fatalf("Failed to issue key: %v", err)
+	}
+	revokedToken, revokedKey, err := keys.Issue(t.Context(), apikey.IssueOptions{Name: "revoked"})
+	if err != nil {
+		t.Fatalf("Failed to issue key: %v", err)
+	}
+	if _, err := keys.Revoke(t.Context(), revokedKey.ID); err != nil {
+		t.Fatalf("Failed to revoke key: %v", err)
+	}
+
+	e := echo.New()
+	e.GET("/profile/:login", func(ctx echo.Context) error {
+		if key := apiKeyFromContext(ctx); key != nil {
+			return ctx.String(http.StatusOK, key.Name)
+		}
+		return ctx.String(http.StatusOK, "anonymous")
+	}, APIKeyMiddleware(keys, cfg))
+
+	request := func(header string, query string) (int, string) {
+		t.Helper()
+		path := "/profile/testuser"
+		if query != "" {
+			path += "?" + cfg.QueryParam + "=" + query
+		}
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if header != "" {
+			req.Header.Set(cfg.Header, header)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code, rec.Body.String()
+	}
+
+	tests := []struct {
+		name     string
+		header   string
+		query    string
+		expected int
+		body     string
+	}{
+		{"missing key", "", "", http.StatusOK, "anonymous"},
+		{"header", token, "", http.StatusOK, "dashboard"},
+		{"query parameter", "", token, http.StatusOK, "dashboard"},
+		{"header before query parameter", token, "ftb_invalid_key", http.StatusOK, "dashboard"},
+		{"invalid header before valid query parameter", "ftb_invalid_key", token, http.StatusUnauthorized, "invalid API key"},
+		{"invalid key", "not a key", "", http.StatusUnauthorized, "invalid API key"},
+		{"revoked key", revokedToken, "", http.StatusUnauthorized, "invalid API key"},
+		// The three requests above used up the quota
+		{"quota exceeded", token, "", http.StatusTooManyRequests, "quota exceeded"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, body := request(test.header, test.query)
+			if code != test.expected || !strings.Contains(body, test.body) {
+				t.Fatalf("Expected %d with %q, got %d: %s", test.expected, test.body, code, body)
+			}
+		})
+	}
+}
+
+func TestAPIKeyAdminRoutes(t *testing.T) {
+	keys, _ := newTestAPIKeys(t)
+
+	e := echo.New()
+	e.Validator = ftvalidator.New()
+	e.POST("/admin/keys", GetIssueAPIKeyHandler(keys))
+	e.GET("/admin/keys", GetListAPIKeysHandler(keys))
+	e.GET("/admin/keys/:id", GetAPIKeyHandler(keys))
+	e.DELETE("/admin/keys/:id", GetRevokeAPIKeyHandler(keys))
+
+	request := func(method string, path string, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := request(http.MethodPost, "/admin/keys", `{"rate":-1}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected a key without name to be rejected, got %d", rec.Code)
+	}
+
+	rec := request(http.MethodPost, "/admin/keys", `{"name":"dashboard","daily_quota":10}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected the key to be issued, got %d: %s", rec.Code, rec.Body)
+	}
+	var issued struct {
+		Token string         `json:"token"`
+		Key   map[string]any `json:"key"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &issued); err != nil {
+		t.Fatalf("Failed to decode issued key: %v", err)
+	}
+	if !strings.HasPrefix(issued.Token, "ftb_") || issued.Key["daily_quota"] != 10.0 {
+		t.Fatalf("Unexpected issued key: %s", rec.Body)
+	}
+	if _, exists := issued.Key["secret_hash"]; exists {
+		t.Fatalf("Expected the secret hash not to be returned, got %s", rec.Body)
+	}
+
+	id, _ := issued.Key["id"].(string)
+	key, err := keys.Authenticate(t.Context(), issued.Token)
+	if err != nil {
+		t.Fatalf("Failed to authenticate issued key: %v", err)
+	}
+	if err := keys.Record(t.Context(), key); err != nil {
+		t.Fatalf("Failed to record usage: %v", err)
+	}
+
+	rec = request(http.MethodGet, "/admin/keys/"+id, "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"usage":{"today":1,"total":1}`) {
+		t.Fatalf("Expected the key with its usage, got %d: %s", rec.Code, rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), "secret_hash") {
+		t.Fatalf("Expected the secret hash not to be returned, got %s", rec.Body)
+	}
+
+	rec = request(http.MethodGet, "/admin/keys", "")
+	if rec.Code != http.StatusOK || strings.Count(rec.Body.String(), `"id":`) != 1 {
+		t.Fatalf("Expected one listed key, got %d: %s", rec.Code, rec.Body)
+	}
+
+	if rec := request(http.MethodDelete, "/admin/keys/"+id, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected the key to be revoked, got %d", rec.Code)
+	}
+	if _, err := keys.Authenticate(t.Context(), issued.Token); err == nil {
+		t.Fatal("Expected the revoked key to be rejected")
+	}
+	if rec := request(http.MethodDelete, "/admin/keys/0123456789abcdef", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected an unknown key not to be found, got %d", rec.Code)
+	}
+	if rec := request(http.MethodGet, "/admin/keys/not-hex", ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected an invalid id to be rejected, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"ftbadge/internal/cache"
+	"ftbadge/internal/ftapi"
+	"ftbadge/internal/privacy"
+	"ftbadge/internal/state"
+)
+
+type SelfService struct {
+	Intra       *ftapi.Client
+	Cache       cache.CacheClient
+	Privacy     *privacy.Registry
+	State       state.Store
+	Sessions    *Sessions
+	RedirectURL string
+}
+
+type callbackParam struct {
+	Code  string `query:"code"`
+	State string `query:"state"`
+	Error string `query:"error"`
+}
+
+type meResponse struct {
+	Login       string      `json:"login"`
+	OptedOut    bool        `json:"opted_out"`
+	Preferences Preferences `json:"preferences"`
+}
+
+type optOutRequest struct {
+	OptedOut *bool `json:"opted_out" validate:"required"`
+}
+
+// Login redirects the student to the Intra authorization page.
+func (ss *SelfService) Login(ctx echo.Context) error {
+	state, err := ss.Sessions.newState(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to start login").SetInternal(err)
+	}
+	authorizeURL, err := ss.Intra.AuthorizeURL(ss.RedirectURL, state)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to start login").SetInternal(err)
+	}
+	return ctx.Redirect(http.StatusFound, authorizeURL)
+}
+
+// Callback proves the student owns their login by exchanging the code for a
+// token and asking Intra who it belongs to.
+func (ss *SelfService) Callback(ctx echo.Context) error {
+	param := callbackParam{}
+	if err := ctx.Bind(&param); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid parameters").SetInternal(err)
+	}
+	if !ss.Sessions.checkState(ctx, param.State) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid login state")
+	}
+	if param.Error != "" || param.Code == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Login was not authorized")
+	}
+
+	accessToken, err := ss.Intra.ExchangeCode(ctx.Request().Context(), param.Code, ss.RedirectURL)
+	var statusError *ftapi.StatusError
+	if errors.As(err, &statusError) && statusError.StatusCode < http.StatusInternalServerError {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Login was not authorized").SetInternal(err)
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusBadGateway, "Failed to complete login").SetInternal(err)
+	}
+
+	login, err := ss.Intra.GetMe(ctx.Request().Context(), accessToken)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadGateway, "Failed to complete login").SetInternal(err)
+	}
+
+	ss.Sessions.Start(ctx, login)
+	return ctx.Redirect(http.StatusFound, "/me")
+}
+
+func (ss *SelfService) Logout(ctx echo.Context) error {
+	ss.Sessions.End(ctx)
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (ss *SelfService) me(ctx echo.Context, login string) error {
+	optedOut, err := ss.Privacy.OptedOut(ctx.Request().Context(), login)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get opt-out").SetInternal(err)
+	}
+	preferences, err := loadPreferences(ctx.Request().Context(), ss.State, login)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get preferences").SetInternal(err)
+	}
+	return ctx.JSON(http.StatusOK, meResponse{login, optedOut, preferences})
+}
+
+func (ss *SelfService) Me(ctx echo.Context) error {
+	return ss.me(ctx, sessionLogin(ctx))
+}
+
+func (ss *SelfService) SetPreferences(ctx echo.Context) error {
+	preferences := Preferences{}
+	if err := ctx.Bind(&preferences); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid parameters").SetInternal(err)
+	}
+	if err := ctx.Validate(preferences); err != nil {
+		return err
+	}
+
+	login := sessionLogin(ctx)
+	if err := savePreferences(ctx.Request().Context(), ss.State, ss.Cache, login, preferences); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to save preferences").SetInternal(err)
+	}
+	return ss.me(ctx, login)
+}
+
+func (ss *SelfService) SetOptOut(ctx echo.Context) error {
+	request := optOutRequest{}
+	if err := ctx.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid parameters").SetInternal(err)
+	}
+	if err := ctx.Validate(request); err != nil {
+		return err
+	}
+
+	login := sessionLogin(ctx)
+	if *request.OptedOut {
+		if err := ss.Privacy.OptOut(ctx.Request().Context(), login); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to opt out").SetInternal(err)
+		}
+		if err := purgeLogin(ctx, ss.Cache, login); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to purge cache").SetInternal(err)
+		}
+	} else if _, err := ss.Privacy.OptIn(ctx.Request().Context(), login); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to opt in").SetInternal(err)
+	}
+	return ss.me(ctx, login)
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"ftbadge/internal/cache"
+	"ftbadge/internal/cache/cachetest"
+	"ftbadge/internal/config"
+	"ftbadge/internal/ftvalidator"
+	"ftbadge/internal/privacy"
+	"ftbadge/internal/state"
+)
+
+func TestSelfServiceLogin(t *testing.T) {
+	cdnMux := http.NewServeMux()
+	cdnMux.HandleFunc("/avatar/testuser", getAvatarHandler(randomImage()))
+	cdnServer := httptest.NewServer(cdnMux)
+	defer cdnServer.Close()
+
+	apiMux := http.NewServeMux()
+	apiMux.HandleFunc("/oauth/token", oauthHandler)
+	apiMux.HandleFunc("/users/testuser", getUserHandler(cdnServer.URL))
+	apiMux.HandleFunc("/me", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test_access_token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"login": "testuser"}`))
+	})
+	apiServer := httptest.NewServer(apiMux)
+	defer apiServer.Close()
+
+	cc := cachetest.NewClient(nil)
+	store := state.NewMemoryStore()
+	ftc := newTestClient(apiServer.URL, cdnServer.URL)
+	sessions := NewSessions(config.AuthConfig{
+		SessionSecret: "test_session_secret_0123456789abcdef",
+		SessionTTL:    time.Hour,
+	})
+	selfService := &SelfService{
+		Intra:       ftc,
+		Cache:       cc,
+		Privacy:     privacy.NewRegistry(store),
+		State:       store,
+		Sessions:    sessions,
+		RedirectURL: "https://badge.example.com/auth/callback",
+	}
+
+	e := echo.New()
+	e.Validator = ftvalidator.New()
+	e.GET("/auth/login", selfService.Login)
+	e.GET("/auth/callback", selfService.Callback)
+	me := e.Group("/me", sessions.RequireSession())
+	me.GET("", selfService.Me)
+	me.PUT("/preferences", selfService.SetPreferences)
+
+	request := func(method string, target string, body string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	cookie := func(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+		t.Helper()
+		for _, cookie := range rec.Result().Cookies() {
+			if cookie.Name == name {
+				return cookie
+			}
+		}
+		t.Fatalf("Expected cookie %q to be set", name)
+		return nil
+	}
+
+	rec := request(http.MethodGet, "/auth/login", "")
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Expected redirect to Intra, got %d", rec.Code)
+	}
+	location, err := url.Parse(rec.Header().Get(echo.HeaderLocation))
+	if err != nil {
+		t.Fatalf("Failed to parse redirect location: %v", err)
+	}
+	oauthState := location.Query().Get("state")
+	stateCookie := cookie(rec, stateCookieName)
+
+	if rec := request(http.MethodGet, "/auth/callback?code=code&state=forged", "", stateCookie); rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected forged state to be rejected, got %d", rec.Code)
+	}
+
+	rec = request(http.MethodGet, "/auth/callback?code=code&state="+oauthState, "", stateCookie)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Expected redirect after login, got %d: %s", rec.Code, rec.Body)
+	}
+	session := cookie(rec, sessionCookieName)
+
+	tampered := &http.Cookie{Name: sessionCookieName, Value: session.Value + "x"}
+	if rec := request(http.MethodGet, "/me", "", tampered); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected tampered session to be rejected, got %d", rec.Code)
+	}
+
+	rec = request(http.MethodPut, "/me/preferences", `{"show_email": true}`, session)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"login":"testuser"`) {
+		t.Fatalf("Failed to save preferences, got %d: %s", rec.Code, rec.Body)
+	}
+
+	profile, err := getProfile(t.Context(), ftc, cc, store, "testuser", nil)
+	if err != nil {
+		t.Fatalf("Failed to get profile: %v", err)
+	}
+	if !profile.ShowEmail {
+		t.Fatal("Expected the email to be shown by the saved preferences")
+	}
+
+	// Preferences are not kept in the cache, so purging or losing it does not
+	// change what is published
+	cm, err := cache.NewCacheManager(t.Context(), cc, "testuser")
+	if err != nil {
+		t.Fatalf("Failed to create cache manager: %v", err)
+	}
+	if err := cm.Purge(t.Context(), cache.CacheKeys...); err != nil {
+		t.Fatalf("Failed to purge cache: %v", err)
+	}
+	for _, client := range []*cachetest.Client{cc, cachetest.NewClient(nil)} {
+		profile, err := getProfile(t.Context(), ftc, client, store, "testuser", nil)
+		if err != nil {
+			t.Fatalf("Failed to get profile: %v", err)
+		}
+		if !profile.ShowEmail {
+			t.Fatal("Expected the saved preferences to survive the loss of the cache")
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/dgraph-io/ristretto/v2"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+
+	"ftbadge/internal/i18n"
+	"ftbadge/internal/tracing"
+	"ftbadge/internal/utils"
+)
+
+const (
+	FieldName   = "name"
+	FieldEmail  = "email"
+	FieldRole   = "role"
+	FieldCursus = "cursus"
+	FieldGrade  = "grade"
+	FieldLevel  = "level"
+)
+
+var badgeFields = []string{FieldName, FieldEmail, FieldRole, FieldCursus, FieldGrade, FieldLevel}
+
+type visibilityParam struct {
+	Fields string `query:"fields"`
+	Hide   string `query:"hide"`
+}
+
+// Visibility lists the fields shown on a badge.
+type Visibility map[string]bool
+
+func parseFieldList(list string) ([]string, error) {
+	var fields []string
+	for field := range strings.SplitSeq(list, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "" {
+			continue
+		}
+		if !slices.Contains(badgeFields, field) {
+			return nil, fmt.Errorf("unknown field %q, expected one of %s", field, strings.Join(badgeFields, ", "))
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func allFields() Visibility {
+	visibility := make(Visibility, len(badgeFields))
+	for _, field := range badgeFields {
+		visibility[field] = true
+	}
+	return visibility
+}
+
+// parseVisibility shows every field unless fields lists the ones to show or
+// hide lists the ones to omit.
+func parseVisibility(param visibilityParam) (Visibility, error) {
+	if param.Fields != "" && param.Hide != "" {
+		return nil, fmt.Errorf("fields and hide cannot be used together")
+	}
+
+	visibility := allFields()
+	if param.Fields != "" {
+		for field := range visibility {
+			visibility[field] = false
+		}
+		fields, err := parseFieldList(param.Fields)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range fields {
+			visibility[field] = true
+		}
+	}
+	if param.Hide != "" {
+		fields, err := parseFieldList(param.Hide)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range fields {
+			visibility[field] = false
+		}
+	}
+	return visibility, nil
+}
+
+func bindVisibility(ctx echo.Context) (Visibility, error) {
+	param := visibilityParam{}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(ctx, &param); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid parameters").SetInternal(err)
+	}
+	visibility, err := parseVisibility(param)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return visibility, nil
+}
+
+type localeParam struct {
+	Lang string `query:"lang"`
+}
+
+// bindLocale negotiates the language of the badge. Responses vary with the
+// Accept-Language header, so shared caches have to key on it.
+func bindLocale(ctx echo.Context) (*i18n.Locale, error) {
+	ctx.Response().Header().Add("Vary", "Accept-Language")
+
+	param := localeParam{}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(ctx, &param); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid parameters").SetInternal(err)
+	}
+	locale, err := i18n.Negotiate(param.Lang, ctx.Request().Header.Get("Accept-Language"))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid language %q", param.Lang)).SetInternal(err)
+	}
+	return locale, nil
+}
+
+// BadgeOptions are chosen through the query parameters of a request.
+type BadgeOptions struct {
+	Show   Visibility
+	Locale *i18n.Locale
+	Shape  AvatarShape
+	Theme  Theme
+}
+
+// Badge is the data given to the profile template. Rows of text are stacked
+// from the top and the block is centered when some of them are omitted.
+type Badge struct {
+	*Profile
+	BadgeOptions
+	GradeLabel string
+	GradeWidth float64
+	NameY      int
+	EmailY     int
+	GradeY     int
+	GradeTextY int
+	CursusY    int
+}
+
+const (
+	badgeBlockTop      = 22
+	badgeBlockBottom   = 109
+	nameAscent         = 18
+	emailSpacing       = 16
+	gradeSpacing       = 12
+	gradeHeight        = 18
+	gradeTextBaseline  = 13
+	cursusSpacing      = 19
+	cursusDescent      = 4
+	gradeFontSize      = 10
+	gradeLetterSpacing = 1
+	gradePadding       = 5
+)
+
+func defaultBadgeOptions() BadgeOptions {
+	return BadgeOptions{Show: allFields(), Locale: i18n.Default(), Shape: avatarShapes[ShapeCircle], Theme: themes[ThemeDark]}
+}
+
+func newBadge(profile *Profile, options BadgeOptions) *Badge {
+	show := maps.Clone(options.Show)
+	// Emails are only shown when the owner opted in
+	show[FieldEmail] = show[FieldEmail] && profile.ShowEmail && profile.Email != ""
+	options.Show = show
+
+	badge := &Badge{Profile: profile, BadgeOptions: options}
+
+	badge.GradeLabel = strings.ToUpper(cmp.Or(profile.Grade, options.Locale.Text(i18n.MessageNotAvailable)))
+	badge.GradeWidth = math.Ceil(utils.SansBoldFont.Measure(badge.GradeLabel, gradeFontSize, gradeLetterSpacing)) + 2*gradePadding
+
+	y := badgeBlockTop
+	bottom := y
+	if show[FieldName] {
+		badge.NameY = y + nameAscent
+		y, bottom = badge.NameY, badge.NameY
+	}
+	if show[FieldEmail] {
+		badge.EmailY = y + emailSpacing
+		if !show[FieldName] {
+			badge.EmailY = y + nameAscent
+		}
+		y, bottom = badge.EmailY, badge.EmailY
+	}
+	if show[FieldGrade] {
+		badge.GradeY = y + gradeSpacing
+		if y == badgeBlockTop {
+			badge.GradeY = y
+		}
+		y = badge.GradeY + gradeHeight
+		bottom = y
+	}
+	if show[FieldCursus] || show[FieldRole] {
+		badge.CursusY = y + cursusSpacing
+		if y == badgeBlockTop {
+			badge.CursusY = y + nameAscent
+		}
+		bottom = badge.CursusY + cursusDescent
+	}
+
+	offset := ((badgeBlockBottom - badgeBlockTop) - (bottom - badgeBlockTop)) / 2
+	badge.NameY += offset
+	badge.EmailY += offset
+	badge.GradeY += offset
+	badge.GradeTextY = badge.GradeY + gradeTextBaseline
+	badge.CursusY += offset
+	return badge
+}
+
+// renderSVG renders tmpl and embeds the subsets of the fonts it uses.
+func renderSVG(ctx context.Context, tmpl *template.Template, data any) ([]byte, error) {
+	_, span := tracing.Start(ctx, "RenderTemplate", attribute.String("template", tmpl.Name()))
+	svg, err := utils.RenderTemplate(tmpl, data)
+	if err == nil {
+		svg, err = utils.EmbedFonts(svg)
+	}
+	tracing.End(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render %s template: %w", tmpl.Name(), err)
+	}
+	return svg, nil
+}
+
+// Rendered badges are kept in memory, so requests for a cached profile do not
+// render the template and subset the fonts again.
+var badgeCache = mustNewBadgeCache()
+
+func mustNewBadgeCache() *ristretto.Cache[string, []byte] {
+	cache, err := ristretto.NewCache(&ristretto.Config[string, []byte]{
+		NumCounters: 1e4,
+		MaxCost:     64 << 20,
+		BufferItems: 64,
+	})
+	if err != nil {
+		panic(fmt.Sprintf("failed to create badge cache: %v", err))
+	}
+	return cache
+}
+
+// badgeCacheKey identifies a badge by the time its profile was cached, so a
+// refreshed or purged profile is rendered again.
+func badgeCacheKey(login string, profile *Profile, options BadgeOptions) string {
+	var shown []string
+	for _, field := range badgeFields {
+		if options.Show[field] {
+			shown = append(shown, field)
+		}
+	}
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%s|%s|%v|%v", strings.Join(shown, ","), options.Locale.Tag, options.Shape, options.Theme)
+	return fmt.Sprintf("%s:%d:%x", login, profile.CachedAt.UnixNano(), hash.Sum64())
+}
+
+func renderBadge(ctx context.Context, login string, profile *Profile, options BadgeOptions) ([]byte, error) {
+	key := badgeCacheKey(login, profile, options)
+	if svg, found := badgeCache.Get(key); found {
+		return svg, nil
+	}
+
+	svg, err := renderSVG(ctx, profileTemplate, newBadge(profile, options))
+	if err != nil {
+		return nil, err
+	}
+	badgeCache.Set(key, svg, int64(len(svg)))
+	return svg, nil
+}
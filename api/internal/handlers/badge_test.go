@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseVisibility(t *testing.T) {
+	tests := []struct {
+		name     string
+		param    visibilityParam
+		hidden   []string
+		expected bool
+	}{
+		{"default", visibilityParam{}, nil, true},
+		{"hide", visibilityParam{Hide: "email, Role"}, []string{FieldEmail, FieldRole}, true},
+		{"fields", visibilityParam{Fields: "name,level"}, []string{FieldEmail, FieldRole, FieldCursus, FieldGrade}, true},
+		{"unknown field", visibilityParam{Hide: "phone"}, nil, false},
+		{"both", visibilityParam{Fields: "name", Hide: "email"}, nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			visibility, err := parseVisibility(test.param)
+			if (err == nil) != test.expected {
+				t.Fatalf("Expected valid=%v, got error %v", test.expected, err)
+			}
+			if err != nil {
+				return
+			}
+
+			expected := allFields()
+			for _, field := range test.hidden {
+				expected[field] = false
+			}
+			if !maps.Equal(visibility, expected) {
+				t.Fatalf("Expected visibility %v, got %v", expected, visibility)
+			}
+		})
+	}
+}
+
+func TestNewBadge(t *testing.T) {
+	profile := &Profile{Name: "Test User", Email: "testuser@student.42angouleme.fr", Role: "Student", Cursus: "42cursus", Grade: "Learner"}
+
+	badge := newBadge(profile, defaultBadgeOptions())
+	if badge.Show[FieldEmail] {
+		t.Fatal("Expected the email to be hidden unless the owner opted in")
+	}
+
+	profile.ShowEmail = true
+	badge = newBadge(profile, defaultBadgeOptions())
+	if !badge.Show[FieldEmail] {
+		t.Fatal("Expected the email to be shown once the owner opted in")
+	}
+	if badge.NameY != 40 || badge.EmailY != 56 || badge.GradeY != 68 || badge.GradeTextY != 81 || badge.CursusY != 105 {
+		t.Fatalf("Expected the original layout with every field, got %+v", badge)
+	}
+
+	options := defaultBadgeOptions()
+	options.Show[FieldEmail] = false
+	compact := newBadge(profile, options)
+	if compact.NameY <= badge.NameY || compact.CursusY >= badge.CursusY {
+		t.Fatalf("Expected rows to be centered without the email, got %+v", compact)
+	}
+
+	data, err := renderBadge(t.Context(), "newbadge", profile, options)
+	if err != nil {
+		t.Fatalf("Failed to render badge: %v", err)
+	}
+	if strings.Contains(string(data), profile.Email) {
+		t.Fatal("Expected the hidden email to be omitted from the badge")
+	}
+}
+
+func TestRenderBadgeCache(t *testing.T) {
+	profile := &Profile{Name: "First Name", Cursus: "42cursus", CachedAt: time.Now().UTC()}
+	render := func(options BadgeOptions) string {
+		data, err := renderBadge(t.Context(), "cachedbadge", profile, options)
+		if err != nil {
+			t.Fatalf("Failed to render badge: %v", err)
+		}
+		badgeCache.Wait()
+		return string(data)
+	}
+
+	render(defaultBadgeOptions())
+	// The profile is only read again when it was cached at another time
+	profile.Name = "Second Name"
+	if svg := render(defaultBadgeOptions()); !strings.Contains(svg, "First Name") {
+		t.Fatalf("Expected the badge to be served from the cache, got %s", svg)
+	}
+
+	light := defaultBadgeOptions()
+	light.Theme = themes[ThemeLight]
+	if svg := render(light); !strings.Contains(svg, "Second Name") {
+		t.Fatalf("Expected other options to render the badge again, got %s", svg)
+	}
+
+	profile.Name = "Third Name"
+	profile.CachedAt = profile.CachedAt.Add(time.Second)
+	if svg := render(defaultBadgeOptions()); !strings.Contains(svg, "Third Name") {
+		t.Fatalf("Expected a refreshed profile to render the badge again, got %s", svg)
+	}
+}
+
+// BenchmarkRenderCachedBadge measures a request for a profile that is already
+// cached, which only renders the badge.
+func BenchmarkRenderCachedBadge(b *testing.B) {
+	profile := &Profile{
+		Avatar:    "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(randomImage()),
+		Name:      "testuser",
+		Email:     "testuser@student.42angouleme.fr",
+		ShowEmail: true,
+		Role:      "student",
+		Cursus:    "42cursus",
+		Grade:     "Transcender",
+		Level:     42,
+		CachedAt:  time.Now().UTC(),
+	}
+
+	for b.Loop() {
+		if _, err := renderBadge(b.Context(), "testuser", profile, defaultBadgeOptions()); err != nil {
+			b.Fatalf("Failed to render badge: %v", err)
+		}
+	}
+}
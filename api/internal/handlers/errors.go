@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"ftbadge/internal/ftapi"
+	"ftbadge/internal/reporting"
+)
+
+func shouldReport(err error) bool {
+	var httpError *echo.HTTPError
+	if errors.As(err, &httpError) {
+		return httpError.Code >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// ReportingScope gives each request its own reporting scope when the reporter
+// supports it, so that server errors and recovered panics are reported with
+// the request and its breadcrumbs.
+func ReportingScope(reporter reporting.Reporter) echo.MiddlewareFunc {
+	scoper, ok := reporter.(reporting.RequestScoper)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if !ok {
+			return next
+		}
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+			ctx.SetRequest(req.WithContext(scoper.WithRequest(req.Context(), req)))
+			return next(ctx)
+		}
+	}
+}
+
+// NewHTTPErrorHandler reports server errors before delegating the response to
+// echo's default error handler.
+func NewHTTPErrorHandler(e *echo.Echo, reporter reporting.Reporter) echo.HTTPErrorHandler {
+	return func(err error, ctx echo.Context) {
+		if shouldReport(err) {
+			report := reporting.Report{
+				Err:       err,
+				Login:     ctx.Param("login"),
+				RequestID: ctx.Response().Header().Get(echo.HeaderXRequestID),
+			}
+
+			var statusError *ftapi.StatusError
+			if errors.As(err, &statusError) {
+				report.UpstreamStatus = statusError.StatusCode
+			}
+
+			reporter.Report(ctx.Request().Context(), report)
+		}
+
+		e.DefaultHTTPErrorHandler(err, ctx)
+	}
+}
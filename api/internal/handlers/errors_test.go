@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+
+	"ftbadge/internal/reporting"
+)
+
+type scopeKey struct{}
+
+// scopedReporter keeps the path of the request scope each report was made in.
+type scopedReporter struct {
+	paths []string
+}
+
+func (sr *scopedReporter) WithRequest(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, scopeKey{}, r.URL.Path)
+}
+
+func (sr *scopedReporter) Report(ctx context.Context, report reporting.Report) {
+	path, _ := ctx.Value(scopeKey{}).(string)
+	sr.paths = append(sr.paths, path)
+}
+
+func (sr *scopedReporter) Flush(timeout time.Duration) {}
+
+func TestReportingScope(t *testing.T) {
+	reporter := &scopedReporter{}
+	e := echo.New()
+	e.HTTPErrorHandler = NewHTTPErrorHandler(e, reporter)
+	e.Use(ReportingScope(reporter))
+	e.Use(middleware.Recover())
+	e.GET("/panic", func(ctx echo.Context) error {
+		panic("render failed")
+	})
+	e.GET("/error", func(ctx echo.Context) error {
+		return echo.NewHTTPError(http.StatusBadGateway, "Failed to render profile")
+	})
+
+	for _, path := range []string{"/panic", "/error"} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code < http.StatusInternalServerError {
+			t.Fatalf("Expected a server error for %s, got %d", path, rec.Code)
+		}
+	}
+
+	if len(reporter.paths) != 2 || reporter.paths[0] != "/panic" || reporter.paths[1] != "/error" {
+		t.Fatalf("Expected both failures to be reported in their request scope, got %q", reporter.paths)
+	}
+}
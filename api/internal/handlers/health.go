@@ -1,13 +1,151 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/labstack/echo/v4"
+
+	"ftbadge/internal/cache"
+	"ftbadge/internal/ftapi"
+	"ftbadge/internal/i18n"
+	"ftbadge/internal/reporting"
+)
+
+const (
+	readinessTimeout = 5 * time.Second
+	// The Intra check requests a new token when none is cached, so its outcome
+	// is reused while the Intra API is failing
+	intraCheckInterval = 10 * time.Second
 )
 
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type componentStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type readinessResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]componentStatus `json:"components"`
+}
+
 func HealthCheckHandler(ctx echo.Context) error {
 	ctx.Response().Header().Set("Cache-Control", "no-store, no-cache, max-age=0")
 	data := map[string]string{"status": "ok"}
 	return ctx.JSON(http.StatusOK, data)
 }
+
+func CacheHealthCheck(cc cache.CacheClient) HealthCheck {
+	return HealthCheck{
+		Name: "cache",
+		Check: func(ctx context.Context) error {
+			return cache.Ping(ctx, cc)
+		},
+	}
+}
+
+// reuseOutcome returns the outcome of the last check for the given interval.
+// Concurrent probes wait for the running check instead of starting another.
+func reuseOutcome(interval time.Duration, check func(ctx context.Context) error) func(ctx context.Context) error {
+	var mu sync.Mutex
+	var checkedAt time.Time
+	var lastErr error
+
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if !checkedAt.IsZero() && time.Since(checkedAt) < interval {
+			return lastErr
+		}
+		lastErr = check(ctx)
+		checkedAt = time.Now()
+		return lastErr
+	}
+}
+
+// IntraHealthCheck reuses the cached access token when there is one, and the
+// outcome of the last check for a few seconds, so frequent probes do not hit
+// the Intra API.
+func IntraHealthCheck(ftc *ftapi.Client, cc cache.CacheClient) HealthCheck {
+	return HealthCheck{
+		Name: "intra",
+		Check: reuseOutcome(intraCheckInterval, func(ctx context.Context) error {
+			cm, err := cache.NewCacheManager(ctx, cc, "")
+			if err != nil {
+				return fmt.Errorf("failed to initialize cache manager: %w", err)
+			}
+			if err := cm.PreFetch(ctx, cache.CacheGroupData); err != nil {
+				return fmt.Errorf("failed to pre-fetch data cache group: %w", err)
+			}
+			if _, err := ftc.GetAccessToken(ctx, cm); err != nil {
+				return err
+			}
+			return cm.Flush(ctx)
+		}),
+	}
+}
+
+func TemplateHealthCheck() HealthCheck {
+	return HealthCheck{
+		Name: "templates",
+		Check: func(ctx context.Context) error {
+			if err := profileTemplate.Execute(io.Discard, newBadge(&Profile{ShowEmail: true}, defaultBadgeOptions())); err != nil {
+				return err
+			}
+			return disabledTemplate.Execute(io.Discard, i18n.Default())
+		},
+	}
+}
+
+func runHealthChecks(ctx context.Context, checks []HealthCheck) readinessResponse {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	response := readinessResponse{
+		Status:     "ok",
+		Components: make(map[string]componentStatus, len(checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Go(func() {
+			status := componentStatus{Status: "ok"}
+			if err := check.Check(ctx); err != nil {
+				status = componentStatus{Status: "error", Error: reporting.Scrub(err.Error())}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			response.Components[check.Name] = status
+			if status.Status != "ok" {
+				response.Status = "unavailable"
+			}
+		})
+	}
+	wg.Wait()
+
+	return response
+}
+
+func GetReadinessHandler(checks ...HealthCheck) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		ctx.Response().Header().Set("Cache-Control", "no-store, no-cache, max-age=0")
+
+		response := runHealthChecks(ctx.Request().Context(), checks)
+		if response.Status != "ok" {
+			return ctx.JSON(http.StatusServiceUnavailable, response)
+		}
+		return ctx.JSON(http.StatusOK, response)
+	}
+}
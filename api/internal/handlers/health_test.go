@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"ftbadge/internal/cache/cachetest"
+)
+
+func TestReadinessHandler(t *testing.T) {
+	apiMux := http.NewServeMux()
+	apiMux.HandleFunc("/oauth/token", oauthHandler)
+	apiServer := httptest.NewServer(apiMux)
+	defer apiServer.Close()
+
+	cc := cachetest.NewClient(nil)
+	ftc := newTestClient(apiServer.URL, apiServer.URL)
+	failing := HealthCheck{
+		Name:  "failing",
+		Check: func(ctx context.Context) error { return errors.New("token for testuser@student.42.fr expired") },
+	}
+
+	tests := []struct {
+		name     string
+		checks   []HealthCheck
+		expected int
+	}{
+		{"ready", []HealthCheck{CacheHealthCheck(cc), IntraHealthCheck(ftc, cc), TemplateHealthCheck()}, http.StatusOK},
+		{"unavailable", []HealthCheck{TemplateHealthCheck(), failing}, http.StatusServiceUnavailable},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/health/ready", nil)
+			rec := httptest.NewRecorder()
+			if err := GetReadinessHandler(test.checks...)(e.NewContext(req, rec)); err != nil {
+				t.Fatalf("Readiness handler failed: %v", err)
+			}
+			if rec.Code != test.expected {
+				t.Fatalf("Expected status %d, got %d: %s", test.expected, rec.Code, rec.Body)
+			}
+
+			var response readinessResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to decode readiness response: %v", err)
+			}
+			if len(response.Components) != len(test.checks) {
+				t.Fatalf("Expected %d components, got %+v", len(test.checks), response.Components)
+			}
+			if failed, exists := response.Components["failing"]; exists && failed.Error != "token for [email] expired" {
+				t.Fatalf("Expected scrubbed component error, got %q", failed.Error)
+			}
+		})
+	}
+
+	if _, found := cc.Peek("access-token"); !found {
+		t.Fatal("Expected readiness check to cache the access token")
+	}
+}
+
+func TestIntraHealthCheckReusesOutcome(t *testing.T) {
+	var apiCalls atomic.Int32
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiCalls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer apiServer.Close()
+
+	check := IntraHealthCheck(newTestClient(apiServer.URL, apiServer.URL), cachetest.NewClient(nil))
+	for range 3 {
+		if err := check.Check(t.Context()); err == nil {
+			t.Fatal("Expected the Intra check to fail")
+		}
+	}
+	if calls := apiCalls.Load(); calls != 1 {
+		t.Fatalf("Expected the failed check to be reused, got %d API calls", calls)
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"ftbadge/internal/cache"
+	"ftbadge/internal/state"
+)
+
+// Preferences are chosen by students through self-service.
+type Preferences struct {
+	// Emails are hidden unless the owner opts in
+	ShowEmail bool `json:"show_email"`
+	// Used unless the theme is set in the query string, dark by default
+	Theme string `json:"theme" validate:"omitempty,oneof=dark light"`
+}
+
+func preferencesKey(login string) string {
+	return "preferences:" + login
+}
+
+// loadPreferences returns the defaults when nothing was saved or when there
+// is no state store.
+func loadPreferences(ctx context.Context, store state.Store, login string) (Preferences, error) {
+	var preferences Preferences
+	if store == nil {
+		return preferences, nil
+	}
+
+	value, exists, err := store.Get(ctx, preferencesKey(login))
+	if err != nil {
+		return preferences, fmt.Errorf("failed to get preferences: %w", err)
+	}
+	if !exists {
+		return preferences, nil
+	}
+	if err := json.Unmarshal([]byte(value), &preferences); err != nil {
+		return preferences, fmt.Errorf("failed to decode preferences: %w", err)
+	}
+	return preferences, nil
+}
+
+// savePreferences stores preferences in the state store, so they are never
+// evicted, and purges the rendered profile so the next request applies them.
+func savePreferences(ctx context.Context, store state.Store, cc cache.CacheClient, login string, preferences Preferences) error {
+	data, err := json.Marshal(preferences)
+	if err != nil {
+		return fmt.Errorf("failed to encode preferences: %w", err)
+	}
+	if err := store.Set(ctx, preferencesKey(login), string(data)); err != nil {
+		return fmt.Errorf("failed to save preferences: %w", err)
+	}
+
+	cm, err := cache.NewCacheManager(ctx, cc, login)
+	if err != nil {
+		return fmt.Errorf("failed to initialize cache manager: %w", err)
+	}
+	if err := cm.Purge(ctx, cache.CacheKeyProfile); err != nil {
+		return fmt.Errorf("failed to purge profile: %w", err)
+	}
+	return nil
+}
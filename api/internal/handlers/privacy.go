@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"ftbadge/internal/cache"
+	"ftbadge/internal/privacy"
+)
+
+func GetOptOutsHandler(registry *privacy.Registry) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		logins, err := registry.List(ctx.Request().Context())
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to list opt-outs").SetInternal(err)
+		}
+		return ctx.JSON(http.StatusOK, logins)
+	}
+}
+
+// GetOptOutHandler also purges the cached profile and avatar of the login.
+func GetOptOutHandler(registry *privacy.Registry, cc cache.CacheClient) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		login, err := bindAdminLogin(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := registry.OptOut(ctx.Request().Context(), login); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to opt out").SetInternal(err)
+		}
+		if err := purgeLogin(ctx, cc, login); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to purge cache").SetInternal(err)
+		}
+		return ctx.NoContent(http.StatusNoContent)
+	}
+}
+
+func GetOptInHandler(registry *privacy.Registry) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		login, err := bindAdminLogin(ctx)
+		if err != nil {
+			return err
+		}
+
+		optedIn, err := registry.OptIn(ctx.Request().Context(), login)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to opt in").SetInternal(err)
+		}
+		if !optedIn {
+			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("Login %q has not opted out", login))
+		}
+		return ctx.NoContent(http.StatusNoContent)
+	}
+}
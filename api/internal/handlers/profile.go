@@ -3,19 +3,28 @@ package handlers
 import (
 	"context"
 	"crypto/md5" // #nosec G501 -- only used for ETag generation
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"net/http"
-	"net/url"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"ftbadge/internal/cache"
 	"ftbadge/internal/ftapi"
+	"ftbadge/internal/metrics"
+	"ftbadge/internal/privacy"
+	"ftbadge/internal/state"
 	"ftbadge/internal/templates"
+	"ftbadge/internal/tracing"
 	"ftbadge/internal/utils"
+	"ftbadge/internal/warmup"
 )
 
 type UserNotFoundError struct {
@@ -26,15 +35,45 @@ func (e *UserNotFoundError) Error() string {
 	return fmt.Sprintf("user %q not found", e.Login)
 }
 
+// Profile is cached as JSON and rendered into a badge for each set of options.
 type Profile struct {
-	Avatar     string
-	Name       string
-	Email      string
-	Role       string
-	Cursus     string
-	Grade      string
-	Experience float64
-	Level      float64
+	Avatar    string
+	Name      string
+	Email     string
+	ShowEmail bool
+	// Theme saved by the owner, used unless the request names one
+	PreferredTheme string
+	Role           string
+	Cursus         string
+	Grade          string
+	Experience     float64
+	Level          float64
+	// When the profile was cached, used to refresh popular profiles before
+	// they expire
+	CachedAt time.Time
+}
+
+const (
+	// Time left to decode and resize the avatar after the Intra requests
+	renderLockMargin       = 5 * time.Second
+	renderLockPollInterval = 200 * time.Millisecond
+	// Other failures are kept shorter than unknown logins, so that a recovered
+	// Intra API is used again quickly
+	renderFailureTTL = 5 * time.Second
+)
+
+// Values of the profile failure cache key
+const (
+	renderFailureNotFound = "not_found"
+	renderFailureError    = "error"
+)
+
+var errRenderFailed = errors.New("profile failed to render on another request")
+
+// renderLockTTL covers the slowest render, which is also bounded by it, so the
+// lock cannot expire while the profile is still rendering.
+func renderLockTTL(ftc *ftapi.Client) time.Duration {
+	return ftc.RenderTimeout() + renderLockMargin
 }
 
 type profileParam struct {
@@ -44,32 +83,91 @@ type profileParam struct {
 var (
 	profileTemplate = template.Must(
 		template.New("profile").
-			Funcs(
-				template.FuncMap{
-					"ToUpper": strings.ToUpper,
-				},
-			).
+			Funcs(utils.TextFuncs).
 			Parse(templates.Profile),
 	)
+	disabledTemplate = template.Must(template.New("disabled").Parse(templates.Disabled))
 )
 
-func createProfile(user *ftapi.User, avatar string) *Profile {
+func createProfile(user *ftapi.User, avatar string, preferences Preferences) *Profile {
 	level, experience := math.Modf(user.Level)
 	experience = max(experience, 0.001) // Ensure experience is never zero to avoid rendering issues
 
 	return &Profile{
-		Avatar:     avatar,
-		Name:       user.Name,
-		Email:      user.Email,
-		Role:       user.Role,
-		Cursus:     user.Cursus,
-		Grade:      user.Grade,
-		Level:      level,
-		Experience: experience * 100,
+		Avatar:         avatar,
+		Name:           user.Name,
+		Email:          user.Email,
+		ShowEmail:      preferences.ShowEmail,
+		PreferredTheme: preferences.Theme,
+		Role:           user.Role,
+		Cursus:         user.Cursus,
+		Grade:          user.Grade,
+		Level:          level,
+		Experience:     experience * 100,
+	}
+}
+
+type ProfileHandlerOptions struct {
+	Tracker  *warmup.Tracker
+	Limiters *ProfileLimiters
+	State    *ServiceState
+	Privacy  *privacy.Registry
+	// Preferences are read from this store, the defaults are used without one
+	Preferences state.Store
+}
+
+// cachedProfile ignores values that are not JSON, such as badges cached by
+// earlier versions, so they are rebuilt.
+func cachedProfile(cm *cache.CacheManager) (*Profile, bool) {
+	value, isCached := cm.Get(cache.CacheKeyProfile)
+	if !isCached {
+		return nil, false
+	}
+	profile := &Profile{}
+	if err := json.Unmarshal([]byte(value), profile); err != nil {
+		return nil, false
+	}
+	return profile, true
+}
+
+// cachedFailure returns the failure of a recent render of the profile.
+func cachedFailure(cm *cache.CacheManager, login string) error {
+	value, isCached := cm.Get(cache.CacheKeyProfileFailure)
+	if !isCached {
+		return nil
+	}
+	if value == renderFailureNotFound {
+		return &UserNotFoundError{Login: login}
+	}
+	return errRenderFailed
+}
+
+// publishFailure records why the profile could not be rendered, unless the
+// request was canceled, so waiting requests do not time out and the
+// following ones do not call the Intra API again.
+func publishFailure(ctx context.Context, cm *cache.CacheManager, renderErr error) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	var err error
+	if _, ok := renderErr.(*UserNotFoundError); ok {
+		err = cm.Set(cache.CacheKeyProfileFailure, renderFailureNotFound)
+	} else {
+		err = cm.SetWithTTL(cache.CacheKeyProfileFailure, renderFailureError, renderFailureTTL)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to cache profile failure: %w", err)
+	}
+	if err := cm.Flush(ctx); err != nil {
+		return fmt.Errorf("failed to flush cache: %w", err)
 	}
+	return nil
 }
 
-func renderProfile(ctx context.Context, ftc *ftapi.Client, cc cache.CacheClient, login string) ([]byte, error) {
+// getProfile returns the cached profile or builds it. charge, when set, is
+// called before anything is fetched from the Intra API.
+func getProfile(ctx context.Context, ftc *ftapi.Client, cc cache.CacheClient, store state.Store, login string, charge func() error) (*Profile, error) {
 	cm, err := cache.NewCacheManager(ctx, cc, login)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize cache manager: %w", err)
@@ -77,9 +175,88 @@ func renderProfile(ctx context.Context, ftc *ftapi.Client, cc cache.CacheClient,
 	if err := cm.PreFetch(ctx, cache.CacheGroupProfile); err != nil {
 		return nil, fmt.Errorf("failed to pre-fetch profile cache group: %w", err)
 	}
-	if cachedProfile, isCached := cm.Get(cache.CacheKeyProfile); isCached {
-		return []byte(cachedProfile), nil
+	if profile, isCached := cachedProfile(cm); isCached {
+		return profile, nil
 	}
+
+	lockTTL := renderLockTTL(ftc)
+	renderDeadline := time.Now().Add(lockTTL)
+	unlock, acquired, err := cm.TryLock(ctx, cache.CacheKeyProfile, lockTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire render lock: %w", err)
+	}
+	if !acquired {
+		profile, err := waitForProfile(ctx, cm, login, lockTTL)
+		if err != nil {
+			return nil, err
+		}
+		if profile != nil {
+			return profile, nil
+		}
+		// The instance holding the lock did not produce a profile in time
+	} else {
+		defer unlock(context.WithoutCancel(ctx))
+
+		// The previous holder may have finished or failed since the first read
+		if err := cm.PreFetch(ctx, cache.CacheGroupRender); err != nil {
+			return nil, fmt.Errorf("failed to pre-fetch render cache group: %w", err)
+		}
+		if profile, isCached := cachedProfile(cm); isCached {
+			return profile, nil
+		}
+		if err := cachedFailure(cm, login); err != nil {
+			return nil, err
+		}
+	}
+
+	if charge != nil {
+		if err := charge(); err != nil {
+			return nil, err
+		}
+	}
+	renderCtx, cancel := context.WithDeadline(ctx, renderDeadline)
+	defer cancel()
+	profile, err := buildProfile(renderCtx, ftc, cm, store, login)
+	if err != nil {
+		if publishErr := publishFailure(ctx, cm, err); publishErr != nil {
+			trace.SpanFromContext(ctx).RecordError(publishErr)
+		}
+		return nil, err
+	}
+	return profile, nil
+}
+
+// waitForProfile returns the profile rendered by the instance holding the
+// render lock, its failure, or nil once the lock has expired.
+func waitForProfile(ctx context.Context, cm *cache.CacheManager, login string, lockTTL time.Duration) (*Profile, error) {
+	ticker := time.NewTicker(renderLockPollInterval)
+	defer ticker.Stop()
+	timeout := time.After(lockTTL)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timeout:
+			return nil, nil
+		case <-ticker.C:
+			if err := cm.PreFetch(ctx, cache.CacheGroupRender); err != nil {
+				return nil, fmt.Errorf("failed to pre-fetch render cache group: %w", err)
+			}
+			if profile, isCached := cachedProfile(cm); isCached {
+				return profile, nil
+			}
+			if err := cachedFailure(cm, login); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func buildProfile(ctx context.Context, ftc *ftapi.Client, cm *cache.CacheManager, store state.Store, login string) (*Profile, error) {
+	start := time.Now()
+	defer func() { metrics.RenderDuration.Observe(time.Since(start).Seconds()) }()
+
 	if err := cm.PreFetch(ctx, cache.CacheGroupData); err != nil {
 		return nil, fmt.Errorf("failed to pre-fetch data cache group: %w", err)
 	}
@@ -92,29 +269,74 @@ func renderProfile(ctx context.Context, ftc *ftapi.Client, cc cache.CacheClient,
 		return nil, &UserNotFoundError{Login: login}
 	}
 
-	avatarURL, err := url.Parse(user.AvatarURL)
+	avatar, err := ftc.GetAvatar(ctx, cm, login, user.AvatarURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse user image URL: %w", err)
+		return nil, fmt.Errorf("failed to get avatar: %w", err)
 	}
-	avatar, err := ftc.GetAvatar(ctx, cm, avatarURL.Path)
+
+	preferences, err := loadPreferences(ctx, store, login)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get avatar: %w", err)
+		return nil, fmt.Errorf("failed to load preferences: %w", err)
 	}
 
-	profile := createProfile(user, avatar)
-	data, err := utils.RenderTemplate(profileTemplate, profile)
+	profile := createProfile(user, avatar, preferences)
+	profile.CachedAt = time.Now().UTC()
+	data, err := json.Marshal(profile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to render profile template: %w", err)
+		return nil, fmt.Errorf("failed to encode profile: %w", err)
 	}
 
-	if err := cm.Set(cache.CacheKeyProfile, string(data)); err != nil {
+	// Profiles with a fallback avatar expire with it, so the real one is shown
+	// once it can be fetched
+	ttl, _ := cache.DefaultTTL(cache.CacheKeyProfile)
+	if ftapi.IsFallbackAvatar(avatar) {
+		ttl = ftapi.FallbackAvatarTTL
+	}
+	if err := cm.SetWithTTL(cache.CacheKeyProfile, string(data), ttl); err != nil {
 		return nil, fmt.Errorf("failed to cache profile: %w", err)
 	}
 	if err := cm.Flush(ctx); err != nil {
 		return nil, fmt.Errorf("failed to flush cache: %w", err)
 	}
 
-	return data, nil
+	return profile, nil
+}
+
+// WarmProfile returns when the profile was cached, which is earlier than now
+// when it was already in the cache.
+func WarmProfile(ctx context.Context, ftc *ftapi.Client, cc cache.CacheClient, store state.Store, login string) (time.Time, error) {
+	profile, err := getProfile(ctx, ftc, cc, store, login, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return profile.CachedAt, nil
+}
+
+// RefreshProfile returns the zero time when another instance is already
+// rendering the profile.
+func RefreshProfile(ctx context.Context, ftc *ftapi.Client, cc cache.CacheClient, store state.Store, login string) (time.Time, error) {
+	cm, err := cache.NewCacheManager(ctx, cc, login)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to initialize cache manager: %w", err)
+	}
+
+	lockTTL := renderLockTTL(ftc)
+	renderCtx, cancel := context.WithTimeout(ctx, lockTTL)
+	defer cancel()
+	unlock, acquired, err := cm.TryLock(renderCtx, cache.CacheKeyProfile, lockTTL)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to acquire render lock: %w", err)
+	}
+	if !acquired {
+		return time.Time{}, nil
+	}
+	defer unlock(context.WithoutCancel(ctx))
+
+	profile, err := buildProfile(renderCtx, ftc, cm, store, login)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return profile.CachedAt, nil
 }
 
 func generateETag(data []byte) string {
@@ -127,7 +349,13 @@ func setCacheHeaders(ctx echo.Context, etag string) {
 	ctx.Response().Header().Add("Etag", etag)
 }
 
-func profileHandler(ctx echo.Context, ftc *ftapi.Client, cc cache.CacheClient) error {
+func profileHandler(ctx echo.Context, ftc *ftapi.Client, cc cache.CacheClient, options ProfileHandlerOptions) error {
+	reqCtx, span := tracing.Start(ctx.Request().Context(), "profileHandler",
+		attribute.String("http.request_id", ctx.Response().Header().Get(echo.HeaderXRequestID)),
+	)
+	defer span.End()
+	ctx.SetRequest(ctx.Request().WithContext(reqCtx))
+
 	ctx.Response().Header().Add("Access-Control-Allow-Origin", "*")
 
 	param := profileParam{}
@@ -137,18 +365,91 @@ func profileHandler(ctx echo.Context, ftc *ftapi.Client, cc cache.CacheClient) e
 	if err := ctx.Validate(param); err != nil {
 		return err
 	}
+	// Intra logins are lowercase and resolved in any case, so the blocklist,
+	// the opt-outs and the cache are all checked with the lowercase login
+	param.Login = strings.ToLower(param.Login)
 	if param.Login == "graph" {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid login: 'graph' is not allowed")
 	}
 
-	data, err := renderProfile(ctx.Request().Context(), ftc, cc, param.Login)
+	span.SetAttributes(attribute.String("login", param.Login))
+
+	if options.State.Blocked(param.Login) {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("Login %q is blocked", param.Login))
+	}
+	locale, err := bindLocale(ctx)
+	if err != nil {
+		return err
+	}
+
+	if options.Privacy != nil {
+		optedOut, err := options.Privacy.OptedOut(ctx.Request().Context(), param.Login)
+		if err != nil {
+			span.RecordError(err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to render profile").SetInternal(err)
+		}
+		if optedOut {
+			data, err := renderSVG(ctx.Request().Context(), disabledTemplate, locale)
+			if err != nil {
+				span.RecordError(err)
+				return echo.NewHTTPError(http.StatusInternalServerError, "Failed to render profile").SetInternal(err)
+			}
+			return sendSVG(ctx, data)
+		}
+	}
+
+	visibility, err := bindVisibility(ctx)
+	if err != nil {
+		return err
+	}
+	shape, err := bindAvatarShape(ctx)
+	if err != nil {
+		return err
+	}
+	theme, err := bindTheme(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Cached profiles are still served during maintenance
+	charge := func() error {
+		if options.State.Maintenance() {
+			return &MaintenanceError{}
+		}
+		return options.Limiters.charge(ctx.RealIP(), apiKeyFromContext(ctx), param.Login)
+	}
+	profile, err := getProfile(ctx.Request().Context(), ftc, cc, options.Preferences, param.Login, charge)
 	if err != nil {
 		if _, ok := err.(*UserNotFoundError); ok {
 			return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("User %q not found", param.Login))
 		}
+		if _, ok := err.(*RateLimitError); ok {
+			metrics.RecordRateLimitRejection(ctx)
+			data := map[string]string{"error": "rate limit exceeded"}
+			return ctx.JSON(http.StatusTooManyRequests, data)
+		}
+		if _, ok := err.(*MaintenanceError); ok {
+			data := map[string]string{"error": "service is under maintenance"}
+			return ctx.JSON(http.StatusServiceUnavailable, data)
+		}
+		span.RecordError(err)
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to render profile").SetInternal(err)
 	}
+	// Only logins that exist are tracked, so unknown ones are never refreshed
+	if options.Tracker != nil {
+		options.Tracker.Record(param.Login, profile.CachedAt)
+	}
+
+	badgeOptions := BadgeOptions{Show: visibility, Locale: locale, Shape: shape, Theme: resolveTheme(theme, profile.PreferredTheme)}
+	data, err := renderBadge(ctx.Request().Context(), param.Login, profile, badgeOptions)
+	if err != nil {
+		span.RecordError(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to render profile").SetInternal(err)
+	}
+	return sendSVG(ctx, data)
+}
 
+func sendSVG(ctx echo.Context, data []byte) error {
 	etag := generateETag(data)
 	clientETag := ctx.Request().Header.Get("If-None-Match")
 	setCacheHeaders(ctx, etag)
@@ -160,8 +461,8 @@ func profileHandler(ctx echo.Context, ftc *ftapi.Client, cc cache.CacheClient) e
 	return ctx.XMLBlob(http.StatusOK, data)
 }
 
-func GetProfileHandler(ftc *ftapi.Client, cc cache.CacheClient) echo.HandlerFunc {
+func GetProfileHandler(ftc *ftapi.Client, cc cache.CacheClient, options ProfileHandlerOptions) echo.HandlerFunc {
 	return func(ctx echo.Context) error {
-		return profileHandler(ctx, ftc, cc)
+		return profileHandler(ctx, ftc, cc, options)
 	}
 }
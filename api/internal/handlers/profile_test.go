@@ -8,11 +8,23 @@ import (
 	"math/rand/v2"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/labstack/echo/v4"
 
 	"ftbadge/internal/cache"
+	"ftbadge/internal/cache/cachetest"
+	"ftbadge/internal/config"
 	"ftbadge/internal/ftapi"
+	"ftbadge/internal/ftvalidator"
+	"ftbadge/internal/privacy"
+	"ftbadge/internal/state"
 	"ftbadge/internal/utils"
+	"ftbadge/internal/warmup"
 )
 
 type cacheMock struct{}
@@ -95,6 +107,86 @@ func randomImage() []byte {
 	return bytes
 }
 
+func newTestClient(apiURL string, cdnURL string) *ftapi.Client {
+	return ftapi.NewClient(config.IntraConfig{
+		APIBaseURL:         apiURL,
+		CDNBaseURL:         cdnURL,
+		ClientID:           "test_client_id",
+		ClientSecret:       "test_client_secret",
+		Timeout:            10 * time.Second,
+		AvatarMaxBytes:     1 << 20,
+		AvatarMaxDimension: 1024,
+	})
+}
+
+func TestRenderProfileCacheHit(t *testing.T) {
+	cc := cachetest.NewClient(nil)
+
+	img := randomImage()
+	var apiCalls atomic.Int32
+
+	cdnMux := http.NewServeMux()
+	cdnMux.HandleFunc("/avatar/testuser", getAvatarHandler(img))
+	cdnServer := httptest.NewServer(cdnMux)
+	defer cdnServer.Close()
+
+	apiMux := http.NewServeMux()
+	apiMux.HandleFunc("/oauth/token", oauthHandler)
+	apiMux.HandleFunc("/users/testuser", getUserHandler(cdnServer.URL))
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiCalls.Add(1)
+		apiMux.ServeHTTP(w, r)
+	}))
+	defer apiServer.Close()
+
+	ftc := newTestClient(apiServer.URL, cdnServer.URL)
+
+	var charges int
+	charge := func() error {
+		charges++
+		return nil
+	}
+
+	first, err := getProfile(t.Context(), ftc, cc, nil, "testuser", charge)
+	if err != nil {
+		t.Fatalf("Failed to render profile: %v", err)
+	}
+	if calls := apiCalls.Load(); calls != 2 {
+		t.Fatalf("Expected token and user requests on a cold cache, got %d API calls", calls)
+	}
+
+	second, err := getProfile(t.Context(), ftc, cc, nil, "testuser", charge)
+	if err != nil {
+		t.Fatalf("Failed to render cached profile: %v", err)
+	}
+	if calls := apiCalls.Load(); calls != 2 {
+		t.Fatalf("Expected cached profile to skip the API, got %d API calls", calls)
+	}
+	if *first != *second {
+		t.Fatal("Expected cached profile to match the rendered profile")
+	}
+	if charges != 1 {
+		t.Fatalf("Expected only the cache miss to be charged, got %d charges", charges)
+	}
+
+	cc.Clock().Advance(24 * time.Hour)
+	if _, err := getProfile(t.Context(), ftc, cc, nil, "testuser", charge); err != nil {
+		t.Fatalf("Failed to render expired profile: %v", err)
+	}
+	if calls := apiCalls.Load(); calls != 4 {
+		t.Fatalf("Expected token and user requests once the profile expired, got %d API calls", calls)
+	}
+
+	denied := func() error { return &RateLimitError{Budget: "ip"} }
+	cc.Clock().Advance(24 * time.Hour)
+	if _, err := getProfile(t.Context(), ftc, cc, nil, "testuser", denied); err == nil {
+		t.Fatal("Expected rate limited render to fail")
+	}
+	if calls := apiCalls.Load(); calls != 4 {
+		t.Fatalf("Expected rate limited render to skip the API, got %d API calls", calls)
+	}
+}
+
 func BenchmarkRenderProfile(b *testing.B) {
 	cc := &cacheMock{}
 
@@ -111,11 +203,295 @@ func BenchmarkRenderProfile(b *testing.B) {
 	apiServer := httptest.NewServer(apiMux)
 	defer apiServer.Close()
 
-	ftc := ftapi.NewClient(apiServer.URL, cdnServer.URL)
+	ftc := newTestClient(apiServer.URL, cdnServer.URL)
 
 	for b.Loop() {
-		if _, err := renderProfile(b.Context(), ftc, cc, "testuser"); err != nil {
-			b.Fatalf("Failed to render profile: %v", err)
+		profile, err := getProfile(b.Context(), ftc, cc, nil, "testuser", nil)
+		if err != nil {
+			b.Fatalf("Failed to get profile: %v", err)
+		}
+		if _, err := renderBadge(b.Context(), "testuser", profile, defaultBadgeOptions()); err != nil {
+			b.Fatalf("Failed to render badge: %v", err)
+		}
+	}
+}
+
+func TestProfileHandlerOptOut(t *testing.T) {
+	var apiCalls atomic.Int32
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiCalls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer apiServer.Close()
+
+	cc := cachetest.NewClient(nil)
+	registry := privacy.NewRegistry(state.NewMemoryStore())
+	if err := registry.OptOut(t.Context(), "testuser"); err != nil {
+		t.Fatalf("Failed to opt out: %v", err)
+	}
+
+	e := echo.New()
+	e.Validator = ftvalidator.New()
+	e.GET("/profile/:login", GetProfileHandler(newTestClient(apiServer.URL, apiServer.URL), cc, ProfileHandlerOptions{Privacy: registry}))
+
+	req := httptest.NewRequest(http.MethodGet, "/profile/testuser", nil)
+	req.Header.Set("Accept-Language", "fr-CA,fr;q=0.9,en;q=0.8")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Badge désactivé") {
+		t.Fatalf("Expected the disabled badge in French, got %d: %s", rec.Code, rec.Body)
+	}
+	if vary := rec.Header().Get("Vary"); vary != "Accept-Language" {
+		t.Fatalf("Expected responses to vary with Accept-Language, got %q", vary)
+	}
+
+	// Intra resolves logins in any case, so the opt-out must match them too
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/profile/TestUser", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Badge disabled") {
+		t.Fatalf("Expected the disabled badge for an uppercase login, got %d: %s", rec.Code, rec.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/profile/testuser?lang=12", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected an invalid language to be rejected, got %d", rec.Code)
+	}
+	if calls := apiCalls.Load(); calls != 0 {
+		t.Fatalf("Expected opted out profile to skip the API, got %d API calls", calls)
+	}
+}
+
+func TestProfileHandlerBlockedLogin(t *testing.T) {
+	var apiCalls atomic.Int32
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiCalls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer apiServer.Close()
+
+	serviceState, err := NewServiceState(t.Context(), state.NewMemoryStore(), []string{"testuser"})
+	if err != nil {
+		t.Fatalf("Failed to create service state: %v", err)
+	}
+
+	e := echo.New()
+	e.Validator = ftvalidator.New()
+	e.GET("/profile/:login", GetProfileHandler(newTestClient(apiServer.URL, apiServer.URL), cachetest.NewClient(nil), ProfileHandlerOptions{State: serviceState}))
+
+	for _, login := range []string{"testuser", "TestUser", "TESTUSER"} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/profile/"+login, nil))
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("Expected %q to be blocked, got %d", login, rec.Code)
+		}
+	}
+	if calls := apiCalls.Load(); calls != 0 {
+		t.Fatalf("Expected blocked logins to skip the API, got %d API calls", calls)
+	}
+}
+
+func TestRenderProfileFallbackAvatar(t *testing.T) {
+	cc := cachetest.NewClient(nil)
+
+	var cdnCalls atomic.Int32
+	cdnServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdnCalls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer cdnServer.Close()
+
+	apiMux := http.NewServeMux()
+	apiMux.HandleFunc("/oauth/token", oauthHandler)
+	apiMux.HandleFunc("/users/testuser", getUserHandler(cdnServer.URL))
+	apiServer := httptest.NewServer(apiMux)
+	defer apiServer.Close()
+
+	ftc := newTestClient(apiServer.URL, cdnServer.URL)
+
+	profile, err := getProfile(t.Context(), ftc, cc, nil, "testuser", nil)
+	if err != nil {
+		t.Fatalf("Failed to render profile with an unavailable CDN: %v", err)
+	}
+	if !ftapi.IsFallbackAvatar(profile.Avatar) {
+		t.Fatalf("Expected a fallback avatar, got %.40q", profile.Avatar)
+	}
+
+	cc.Clock().Advance(ftapi.FallbackAvatarTTL / 2)
+	if _, err := getProfile(t.Context(), ftc, cc, nil, "testuser", nil); err != nil {
+		t.Fatalf("Failed to render cached profile: %v", err)
+	}
+	if calls := cdnCalls.Load(); calls != 1 {
+		t.Fatalf("Expected the fallback avatar to be cached, got %d CDN calls", calls)
+	}
+
+	cc.Clock().Advance(ftapi.FallbackAvatarTTL)
+	if _, err := getProfile(t.Context(), ftc, cc, nil, "testuser", nil); err != nil {
+		t.Fatalf("Failed to render expired profile: %v", err)
+	}
+	if calls := cdnCalls.Load(); calls != 2 {
+		t.Fatalf("Expected the real avatar to be retried once the fallback expired, got %d CDN calls", calls)
+	}
+}
+
+func TestProfileHandlerTracksRenderedLogins(t *testing.T) {
+	cdnMux := http.NewServeMux()
+	cdnMux.HandleFunc("/avatar/testuser", getAvatarHandler(randomImage()))
+	cdnServer := httptest.NewServer(cdnMux)
+	defer cdnServer.Close()
+
+	apiMux := http.NewServeMux()
+	apiMux.HandleFunc("/oauth/token", oauthHandler)
+	apiMux.HandleFunc("/users/testuser", getUserHandler(cdnServer.URL))
+	apiServer := httptest.NewServer(apiMux)
+	defer apiServer.Close()
+
+	ftc := newTestClient(apiServer.URL, cdnServer.URL)
+	cc := cachetest.NewClient(nil)
+	tracker := warmup.NewTracker(10)
+	e := echo.New()
+	e.Validator = ftvalidator.New()
+	e.GET("/profile/:login", GetProfileHandler(ftc, cc, ProfileHandlerOptions{Tracker: tracker}))
+
+	start := time.Now()
+	for login, expected := range map[string]int{"testuser": http.StatusOK, "unknown": http.StatusNotFound} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/profile/"+login, nil))
+		if rec.Code != expected {
+			t.Fatalf("Expected status %d for %q, got %d", expected, login, rec.Code)
 		}
 	}
+
+	if top := tracker.Top(10); len(top) != 1 || top[0] != "testuser" {
+		t.Fatalf("Expected only the rendered login to be tracked, got %q", top)
+	}
+	cachedAt, known := tracker.RefreshedAt("testuser")
+	if !known || cachedAt.Before(start) {
+		t.Fatalf("Expected the render time to be tracked, got %v", cachedAt)
+	}
+
+	// Another instance sharing the cache tracks when the profile was written,
+	// not when it first served it
+	otherTracker := warmup.NewTracker(10)
+	other := echo.New()
+	other.Validator = ftvalidator.New()
+	other.GET("/profile/:login", GetProfileHandler(ftc, cc, ProfileHandlerOptions{Tracker: otherTracker}))
+	rec := httptest.NewRecorder()
+	other.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/profile/testuser", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if refreshedAt, known := otherTracker.RefreshedAt("testuser"); !known || !refreshedAt.Equal(cachedAt) {
+		t.Fatalf("Expected the cache write time %v to be tracked, got %v", cachedAt, refreshedAt)
+	}
+}
+
+func TestRenderProfileCachesNotFound(t *testing.T) {
+	var userCalls atomic.Int32
+	apiMux := http.NewServeMux()
+	apiMux.HandleFunc("/oauth/token", oauthHandler)
+	apiMux.HandleFunc("/users/unknown", func(w http.ResponseWriter, r *http.Request) {
+		userCalls.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	})
+	apiServer := httptest.NewServer(apiMux)
+	defer apiServer.Close()
+
+	cc := cachetest.NewClient(nil)
+	ftc := newTestClient(apiServer.URL, apiServer.URL)
+
+	var charges int
+	charge := func() error {
+		charges++
+		return nil
+	}
+	for range 2 {
+		_, err := getProfile(t.Context(), ftc, cc, nil, "unknown", charge)
+		if _, ok := err.(*UserNotFoundError); !ok {
+			t.Fatalf("Expected a user not found error, got %v", err)
+		}
+	}
+	if calls := userCalls.Load(); calls != 1 {
+		t.Fatalf("Expected the unknown login to be cached, got %d user requests", calls)
+	}
+	if charges != 1 {
+		t.Fatalf("Expected only the first render to be charged, got %d charges", charges)
+	}
+}
+
+func TestRenderProfileWaiterReturnsFailure(t *testing.T) {
+	server := miniredis.RunT(t)
+	rc, err := cache.NewRedisClient("redis://" + server.Addr())
+	if err != nil {
+		t.Fatalf("Failed to create Redis client: %v", err)
+	}
+
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected the waiting request to skip the API, got %s", r.URL.Path)
+	}))
+	defer apiServer.Close()
+
+	// Another instance holds the render lock and fails to find the user
+	server.Set("lock:profile:unknown", "token")
+	go func() {
+		time.Sleep(renderLockPollInterval)
+		server.Set("profile-failure:unknown", renderFailureNotFound)
+	}()
+
+	ftc := newTestClient(apiServer.URL, apiServer.URL)
+	start := time.Now()
+	_, err = getProfile(t.Context(), ftc, rc, nil, "unknown", nil)
+	if _, ok := err.(*UserNotFoundError); !ok {
+		t.Fatalf("Expected the failure of the lock holder, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= renderLockTTL(ftc)/2 {
+		t.Fatalf("Expected the waiting request to return on the failure, took %v", elapsed)
+	}
+}
+
+func TestProfileHandlerTheme(t *testing.T) {
+	cdnMux := http.NewServeMux()
+	cdnMux.HandleFunc("/avatar/testuser", getAvatarHandler(randomImage()))
+	cdnServer := httptest.NewServer(cdnMux)
+	defer cdnServer.Close()
+
+	apiMux := http.NewServeMux()
+	apiMux.HandleFunc("/oauth/token", oauthHandler)
+	apiMux.HandleFunc("/users/testuser", getUserHandler(cdnServer.URL))
+	apiServer := httptest.NewServer(apiMux)
+	defer apiServer.Close()
+
+	cc := cachetest.NewClient(nil)
+	store := state.NewMemoryStore()
+	e := echo.New()
+	e.Validator = ftvalidator.New()
+	e.GET("/profile/:login", GetProfileHandler(newTestClient(apiServer.URL, cdnServer.URL), cc, ProfileHandlerOptions{Preferences: store}))
+
+	render := func(query string) string {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/profile/testuser"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+		}
+		return rec.Body.String()
+	}
+	background := func(theme string) string {
+		return `stop-color="` + themes[theme].BackgroundEnd + `"`
+	}
+
+	if svg := render(""); !strings.Contains(svg, background(ThemeDark)) {
+		t.Fatalf("Expected the dark theme by default, got %s", svg)
+	}
+
+	if err := savePreferences(t.Context(), store, cc, "testuser", Preferences{Theme: ThemeLight}); err != nil {
+		t.Fatalf("Failed to save preferences: %v", err)
+	}
+	if svg := render(""); !strings.Contains(svg, background(ThemeLight)) {
+		t.Fatalf("Expected the saved light theme, got %s", svg)
+	}
+	if svg := render("?theme=dark"); !strings.Contains(svg, background(ThemeDark)) {
+		t.Fatalf("Expected the query string to override the saved theme, got %s", svg)
+	}
 }
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/labstack/echo/v4/middleware"
+
+	"ftbadge/internal/apikey"
+	"ftbadge/internal/ratelimit"
+)
+
+type RateLimitError struct {
+	Budget string
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s rate limit exceeded", e.Budget)
+}
+
+// ProfileLimiters are only charged when a profile is not cached and has to be
+// fetched from the Intra API, so cache hits never consume budget.
+type ProfileLimiters struct {
+	// Keyed by client IP, replaced by the limit of the API key when one is used
+	IP      middleware.RateLimiterStore
+	APIKeys *apikey.Manager
+	// Keyed by client IP or API key and charged once per distinct login, so
+	// a single client cannot enumerate logins
+	Login *ratelimit.DistinctStore
+}
+
+func (pl *ProfileLimiters) charge(ip string, key *apikey.Key, login string) error {
+	if pl == nil {
+		return nil
+	}
+
+	if key != nil && pl.APIKeys != nil {
+		allowed, err := pl.APIKeys.Allow(key)
+		if err != nil {
+			return fmt.Errorf("failed to check api_key rate limit: %w", err)
+		}
+		if !allowed {
+			return &RateLimitError{Budget: "api_key"}
+		}
+		ip = ""
+	}
+
+	if pl.IP != nil && ip != "" {
+		allowed, err := pl.IP.Allow(ip)
+		if err != nil {
+			return fmt.Errorf("failed to check ip rate limit: %w", err)
+		}
+		if !allowed {
+			return &RateLimitError{Budget: "ip"}
+		}
+	}
+
+	if pl.Login == nil {
+		return nil
+	}
+	client := "ip:" + ip
+	if key != nil {
+		client = "key:" + key.ID
+	}
+	allowed, err := pl.Login.Allow(client, login)
+	if err != nil {
+		return fmt.Errorf("failed to check login rate limit: %w", err)
+	}
+	if !allowed {
+		return &RateLimitError{Budget: "login"}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/time/rate"
+
+	"ftbadge/internal/cache/cachetest"
+	"ftbadge/internal/ftvalidator"
+	"ftbadge/internal/ratelimit"
+)
+
+func TestProfileHandlerLimitsDistinctLogins(t *testing.T) {
+	var userCalls atomic.Int32
+	apiMux := http.NewServeMux()
+	apiMux.HandleFunc("/oauth/token", oauthHandler)
+	apiMux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		userCalls.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	})
+	apiServer := httptest.NewServer(apiMux)
+	defer apiServer.Close()
+
+	limiters := &ProfileLimiters{
+		IP: middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{Rate: rate.Inf}),
+		Login: ratelimit.NewDistinctStore(
+			ratelimit.NewMemoryMarker(time.Minute),
+			middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{Rate: 0.001, Burst: 3}),
+		),
+	}
+	e := echo.New()
+	e.Validator = ftvalidator.New()
+	e.GET("/profile/:login", GetProfileHandler(newTestClient(apiServer.URL, apiServer.URL), cachetest.NewClient(nil), ProfileHandlerOptions{Limiters: limiters}))
+
+	request := func(ip string, login string) int {
+		req := httptest.NewRequest(http.MethodGet, "/profile/"+login, nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for index := range 5 {
+		expected := http.StatusNotFound
+		if index >= 3 {
+			expected = http.StatusTooManyRequests
+		}
+		if code := request("203.0.113.1", fmt.Sprintf("user%d", index)); code != expected {
+			t.Fatalf("Expected status %d for login %d, got %d", expected, index, code)
+		}
+	}
+	if calls := userCalls.Load(); calls != 3 {
+		t.Fatalf("Expected denied logins to skip the API, got %d user requests", calls)
+	}
+
+	if code := request("203.0.113.2", "user3"); code != http.StatusNotFound {
+		t.Fatalf("Expected another client to have its own budget, got %d", code)
+	}
+}
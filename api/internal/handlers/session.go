@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"ftbadge/internal/config"
+)
+
+const (
+	sessionCookieName  = "ftbadge_session"
+	stateCookieName    = "ftbadge_oauth_state"
+	stateCookieTTL     = 10 * time.Minute
+	sessionContextKey  = "session_login"
+	oauthStateByteSize = 16
+)
+
+// Sessions are stateless: the cookie holds the login and expiry, signed with
+// the configured secret.
+type Sessions struct {
+	secret []byte
+	ttl    time.Duration
+	secure bool
+	now    func() time.Time
+}
+
+func NewSessions(cfg config.AuthConfig) *Sessions {
+	return &Sessions{[]byte(cfg.SessionSecret), cfg.SessionTTL, cfg.SecureCookies, time.Now}
+}
+
+func (s *Sessions) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Sessions) encode(login string, expiresAt time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(login + "|" + strconv.FormatInt(expiresAt.Unix(), 10)))
+	return payload + "." + s.sign(payload)
+}
+
+func (s *Sessions) decode(value string) (string, bool) {
+	payload, signature, found := strings.Cut(value, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(s.sign(payload))) {
+		return "", false
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", false
+	}
+	login, expiry, found := strings.Cut(string(decoded), "|")
+	if !found {
+		return "", false
+	}
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || s.now().Unix() >= expiresAt {
+		return "", false
+	}
+	return login, true
+}
+
+func (s *Sessions) cookie(name string, value string, maxAge time.Duration) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   s.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (s *Sessions) Start(ctx echo.Context, login string) {
+	ctx.SetCookie(s.cookie(sessionCookieName, s.encode(login, s.now().Add(s.ttl)), s.ttl))
+}
+
+func (s *Sessions) End(ctx echo.Context) {
+	ctx.SetCookie(s.cookie(sessionCookieName, "", -1))
+}
+
+func (s *Sessions) Login(ctx echo.Context) (string, bool) {
+	cookie, err := ctx.Cookie(sessionCookieName)
+	if err != nil {
+		return "", false
+	}
+	return s.decode(cookie.Value)
+}
+
+// RequireSession rejects requests without a valid session and exposes the
+// login of the student to the next handlers.
+func (s *Sessions) RequireSession() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			login, ok := s.Login(ctx)
+			if !ok {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Not signed in")
+			}
+			ctx.Set(sessionContextKey, login)
+			return next(ctx)
+		}
+	}
+}
+
+func sessionLogin(ctx echo.Context) string {
+	login, _ := ctx.Get(sessionContextKey).(string)
+	return login
+}
+
+func (s *Sessions) newState(ctx echo.Context) (string, error) {
+	buffer := make([]byte, oauthStateByteSize)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	state := hex.EncodeToString(buffer)
+	ctx.SetCookie(s.cookie(stateCookieName, state, stateCookieTTL))
+	return state, nil
+}
+
+func (s *Sessions) checkState(ctx echo.Context, state string) bool {
+	cookie, err := ctx.Cookie(stateCookieName)
+	ctx.SetCookie(s.cookie(stateCookieName, "", -1))
+	if err != nil || state == "" {
+		return false
+	}
+	return hmac.Equal([]byte(cookie.Value), []byte(state))
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	ShapeCircle  = "circle"
+	ShapeRounded = "rounded"
+	ShapeSquare  = "square"
+	ShapeHex     = "hex"
+)
+
+var shapeNames = []string{ShapeCircle, ShapeRounded, ShapeSquare, ShapeHex}
+
+// AvatarShape holds the SVG paths clipping the avatar and drawing the level
+// ring around it. Rings start at the top and go clockwise, so the level
+// progress is drawn the same way for every shape.
+type AvatarShape struct {
+	Clip string
+	Ring string
+}
+
+const (
+	avatarCenterX = 64
+	avatarCenterY = 70
+	avatarRadius  = 50
+	ringGap       = 4
+	roundedRatio  = 0.2
+)
+
+var avatarShapes = map[string]AvatarShape{
+	ShapeCircle: {
+		Clip: roundedSquarePath(avatarRadius, avatarRadius),
+		Ring: roundedSquarePath(avatarRadius+ringGap, avatarRadius+ringGap),
+	},
+	ShapeRounded: {
+		Clip: roundedSquarePath(avatarRadius, avatarRadius*roundedRatio),
+		Ring: roundedSquarePath(avatarRadius+ringGap, avatarRadius*roundedRatio+ringGap),
+	},
+	ShapeSquare: {
+		Clip: roundedSquarePath(avatarRadius, 0),
+		Ring: roundedSquarePath(avatarRadius+ringGap, 0),
+	},
+	ShapeHex: {
+		Clip: hexagonPath(avatarRadius),
+		// The gap is measured between the sides rather than the corners
+		Ring: hexagonPath(avatarRadius + ringGap/math.Cos(math.Pi/6)),
+	},
+}
+
+func formatCoordinate(value float64) string {
+	return strconv.FormatFloat(math.Round(value*10)/10, 'f', -1, 64)
+}
+
+func point(x float64, y float64) string {
+	return formatCoordinate(x) + " " + formatCoordinate(y)
+}
+
+// roundedSquarePath returns a square of the given half side around the avatar
+// center. A corner radius equal to the half side draws a circle.
+func roundedSquarePath(half float64, radius float64) string {
+	left, right := avatarCenterX-half, avatarCenterX+half
+	top, bottom := avatarCenterY-half, avatarCenterY+half
+	arc := func(x float64, y float64) string {
+		if radius == 0 {
+			return ""
+		}
+		return fmt.Sprintf("A%s %s 0 0 1 %s", formatCoordinate(radius), formatCoordinate(radius), point(x, y))
+	}
+
+	line := func(x float64, y float64) string {
+		if radius == half {
+			return ""
+		}
+		return "L" + point(x, y)
+	}
+
+	var path strings.Builder
+	path.WriteString("M" + point(avatarCenterX, top))
+	path.WriteString(line(right-radius, top) + arc(right, top+radius))
+	path.WriteString(line(right, bottom-radius) + arc(right-radius, bottom))
+	path.WriteString(line(left+radius, bottom) + arc(left, bottom-radius))
+	path.WriteString(line(left, top+radius) + arc(left+radius, top))
+	path.WriteString("Z")
+	return path.String()
+}
+
+// hexagonPath returns a pointy-top hexagon with the given circumradius.
+func hexagonPath(radius float64) string {
+	var path strings.Builder
+	for corner := range 6 {
+		angle := math.Pi/3*float64(corner) - math.Pi/2
+		command := "L"
+		if corner == 0 {
+			command = "M"
+		}
+		path.WriteString(command + point(avatarCenterX+radius*math.Cos(angle), avatarCenterY+radius*math.Sin(angle)))
+	}
+	path.WriteString("Z")
+	return path.String()
+}
+
+type shapeParam struct {
+	Avatar string `query:"avatar"`
+}
+
+func bindAvatarShape(ctx echo.Context) (AvatarShape, error) {
+	param := shapeParam{}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(ctx, &param); err != nil {
+		return AvatarShape{}, echo.NewHTTPError(http.StatusBadRequest, "Invalid parameters").SetInternal(err)
+	}
+	if param.Avatar == "" {
+		return avatarShapes[ShapeCircle], nil
+	}
+
+	shape, exists := avatarShapes[strings.ToLower(param.Avatar)]
+	if !exists {
+		message := fmt.Sprintf("Unknown avatar shape %q, expected one of %s", param.Avatar, strings.Join(shapeNames, ", "))
+		return AvatarShape{}, echo.NewHTTPError(http.StatusBadRequest, message)
+	}
+	return shape, nil
+}
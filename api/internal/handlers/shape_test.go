@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestAvatarShapes(t *testing.T) {
+	if len(avatarShapes) != len(shapeNames) {
+		t.Fatalf("Expected %d shapes, got %d", len(shapeNames), len(avatarShapes))
+	}
+	for name, shape := range avatarShapes {
+		if !slices.Contains(shapeNames, name) {
+			t.Fatalf("Expected shape %q to be listed in shapeNames", name)
+		}
+		// Rings start at the top of the avatar to draw the level progress
+		if !strings.HasPrefix(shape.Ring, "M64 ") || !strings.HasSuffix(shape.Clip, "Z") {
+			t.Fatalf("Unexpected paths for shape %q: %+v", name, shape)
+		}
+	}
+
+	expected := "M64 20A50 50 0 0 1 114 70A50 50 0 0 1 64 120A50 50 0 0 1 14 70A50 50 0 0 1 64 20Z"
+	if clip := avatarShapes[ShapeCircle].Clip; clip != expected {
+		t.Fatalf("Expected circle clip %q, got %q", expected, clip)
+	}
+	expected = "M64 16L118 16L118 124L10 124L10 16Z"
+	if ring := avatarShapes[ShapeSquare].Ring; ring != expected {
+		t.Fatalf("Expected square ring %q, got %q", expected, ring)
+	}
+}
+
+func TestBindAvatarShape(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected AvatarShape
+		code     int
+	}{
+		{"", avatarShapes[ShapeCircle], 0},
+		{"avatar=Hex", avatarShapes[ShapeHex], 0},
+		{"avatar=star", AvatarShape{}, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/profile/testuser?"+test.query, nil)
+			shape, err := bindAvatarShape(echo.New().NewContext(req, httptest.NewRecorder()))
+
+			var httpError *echo.HTTPError
+			if test.code != 0 {
+				if !errors.As(err, &httpError) || httpError.Code != test.code {
+					t.Fatalf("Expected status %d, got %v", test.code, err)
+				}
+				return
+			}
+			if err != nil || shape != test.expected {
+				t.Fatalf("Expected shape %+v, got %+v: %v", test.expected, shape, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	ThemeDark  = "dark"
+	ThemeLight = "light"
+)
+
+var themeNames = []string{ThemeDark, ThemeLight}
+
+// Theme holds the colors of the badge. The accent of the level and the colors
+// of the grades are the same in every theme.
+type Theme struct {
+	BackgroundStart string
+	BackgroundEnd   string
+	Track           string
+	Surface         string
+	Text            string
+	Secondary       string
+	Muted           string
+	Separator       string
+}
+
+var themes = map[string]Theme{
+	ThemeDark: {
+		BackgroundStart: "#1a1c23",
+		BackgroundEnd:   "#0d0e12",
+		Track:           "#3a4149",
+		Surface:         "#1a1c23",
+		Text:            "#fff",
+		Secondary:       "#c9d1d9",
+		Muted:           "#8b949e",
+		Separator:       "#484f58",
+	},
+	ThemeLight: {
+		BackgroundStart: "#fff",
+		BackgroundEnd:   "#eef1f5",
+		Track:           "#d0d7de",
+		Surface:         "#fff",
+		Text:            "#1f2328",
+		Secondary:       "#24292f",
+		Muted:           "#57606a",
+		Separator:       "#afb8c1",
+	},
+}
+
+type themeParam struct {
+	Theme string `query:"theme"`
+}
+
+// bindTheme returns the theme named in the query string, or an empty name when
+// the saved preference applies.
+func bindTheme(ctx echo.Context) (string, error) {
+	param := themeParam{}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(ctx, &param); err != nil {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "Invalid parameters").SetInternal(err)
+	}
+	if param.Theme == "" {
+		return "", nil
+	}
+
+	name := strings.ToLower(param.Theme)
+	if _, exists := themes[name]; !exists {
+		message := fmt.Sprintf("Unknown theme %q, expected one of %s", param.Theme, strings.Join(themeNames, ", "))
+		return "", echo.NewHTTPError(http.StatusBadRequest, message)
+	}
+	return name, nil
+}
+
+// resolveTheme prefers the requested theme, then the one saved by the owner.
+// Themes saved before they were removed fall back to dark.
+func resolveTheme(requested string, preferred string) Theme {
+	if theme, exists := themes[cmp.Or(requested, preferred)]; exists {
+		return theme
+	}
+	return themes[ThemeDark]
+}
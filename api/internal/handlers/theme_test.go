@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestBindTheme(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+		code     int
+	}{
+		{"", "", 0},
+		{"theme=Light", ThemeLight, 0},
+		{"theme=solarized", "", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/profile/testuser?"+test.query, nil)
+			theme, err := bindTheme(echo.New().NewContext(req, httptest.NewRecorder()))
+
+			var httpError *echo.HTTPError
+			if test.code != 0 {
+				if !errors.As(err, &httpError) || httpError.Code != test.code {
+					t.Fatalf("Expected status %d, got %v", test.code, err)
+				}
+				return
+			}
+			if err != nil || theme != test.expected {
+				t.Fatalf("Expected theme %q, got %q: %v", test.expected, theme, err)
+			}
+		})
+	}
+}
+
+func TestResolveTheme(t *testing.T) {
+	tests := []struct {
+		requested string
+		preferred string
+		expected  string
+	}{
+		{"", "", ThemeDark},
+		{"", ThemeLight, ThemeLight},
+		{ThemeDark, ThemeLight, ThemeDark},
+		{"", "removed", ThemeDark},
+	}
+
+	for _, test := range tests {
+		if theme := resolveTheme(test.requested, test.preferred); theme != themes[test.expected] {
+			t.Fatalf("Expected theme %q for %q over %q, got %+v", test.expected, test.requested, test.preferred, theme)
+		}
+	}
+}
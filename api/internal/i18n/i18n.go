@@ -0,0 +1,68 @@
+package i18n
+
+import (
+	"fmt"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+var matcher = language.NewMatcher(supported)
+
+// Locale translates labels and formats numbers for one of the supported
+// languages.
+type Locale struct {
+	Tag      language.Tag
+	messages map[string]string
+	printer  *message.Printer
+}
+
+func newLocale(tag language.Tag) *Locale {
+	base, _ := tag.Base()
+	return &Locale{
+		Tag:      tag,
+		messages: messages[base.String()],
+		printer:  message.NewPrinter(tag),
+	}
+}
+
+// Default returns the locale used when no supported language is requested.
+func Default() *Locale {
+	return newLocale(supported[0])
+}
+
+// Negotiate picks the language given by lang, then the ones of the
+// Accept-Language header. An invalid lang is an error while an unsupported one
+// falls back to the closest supported language.
+func Negotiate(lang string, acceptLanguage string) (*Locale, error) {
+	if lang != "" {
+		if _, err := language.Parse(lang); err != nil {
+			return nil, fmt.Errorf("invalid language %q: %w", lang, err)
+		}
+	}
+	_, index := language.MatchStrings(matcher, lang, acceptLanguage)
+	return newLocale(supported[index]), nil
+}
+
+// Text returns the label for key, formatted with args when given. Labels
+// missing from a catalog fall back to English.
+func (l *Locale) Text(key string, args ...any) string {
+	text, exists := l.messages[key]
+	if !exists {
+		text = messages["en"][key]
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+func (l *Locale) Number(value float64) string {
+	return l.printer.Sprint(number.Decimal(value))
+}
+
+// Percent formats a value between 0 and 100 without decimals.
+func (l *Locale) Percent(value float64) string {
+	return l.printer.Sprint(number.Percent(value/100, number.MaxFractionDigits(0)))
+}
@@ -0,0 +1,95 @@
+package i18n
+
+import (
+	"testing"
+
+	"golang.org/x/text/language"
+
+	"ftbadge/internal/utils"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name           string
+		lang           string
+		acceptLanguage string
+		expected       language.Tag
+	}{
+		{"default", "", "", language.English},
+		{"query", "de", "fr", language.German},
+		{"region", "", "fr-CA,fr;q=0.9,en;q=0.8", language.French},
+		{"quality", "", "ko, de;q=0.9, fr;q=0.5", language.German},
+		{"no glyphs", "ja", "", language.English},
+		{"unsupported", "ko", "", language.English},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			locale, err := Negotiate(test.lang, test.acceptLanguage)
+			if err != nil {
+				t.Fatalf("Failed to negotiate language: %v", err)
+			}
+			if locale.Tag != test.expected {
+				t.Fatalf("Expected %s, got %s", test.expected, locale.Tag)
+			}
+		})
+	}
+
+	if _, err := Negotiate("12", ""); err == nil {
+		t.Fatal("Expected an invalid language to be rejected")
+	}
+}
+
+func TestLocale(t *testing.T) {
+	tests := []struct {
+		lang     string
+		progress string
+	}{
+		{"en", "Level 1,234 (46%)"},
+		{"fr", "Niveau 1\u00a0234 (46\u00a0%)"},
+		{"de", "Level 1.234 (46\u00a0%)"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.lang, func(t *testing.T) {
+			locale, err := Negotiate(test.lang, "")
+			if err != nil {
+				t.Fatalf("Failed to negotiate language: %v", err)
+			}
+			progress := locale.Text(MessageLevelProgress, locale.Number(1234), locale.Percent(45.67))
+			if progress != test.progress {
+				t.Fatalf("Expected %q, got %q", test.progress, progress)
+			}
+		})
+	}
+}
+
+func TestCatalogsAreComplete(t *testing.T) {
+	for _, tag := range supported {
+		base, _ := tag.Base()
+		catalog, exists := messages[base.String()]
+		if !exists {
+			t.Fatalf("Missing catalog for %s", tag)
+		}
+		for key := range messages["en"] {
+			if catalog[key] == "" {
+				t.Fatalf("Missing %q label for %s", key, tag)
+			}
+		}
+	}
+}
+
+// Fallback fonts would draw labels wider or narrower than they are measured.
+func TestCatalogsHaveGlyphs(t *testing.T) {
+	for lang, catalog := range messages {
+		for key, label := range catalog {
+			for _, r := range label {
+				for _, font := range []*utils.Font{utils.SansFont, utils.SansMediumFont, utils.SansBoldFont} {
+					if len(font.Glyphs(string(r))) != 2 {
+						t.Fatalf("Missing glyph for %q in the %q label of %s", r, key, lang)
+					}
+				}
+			}
+		}
+	}
+}
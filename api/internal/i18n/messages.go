@@ -0,0 +1,70 @@
+package i18n
+
+import "golang.org/x/text/language"
+
+const (
+	MessageLevel            = "level"
+	MessageLevelProgress    = "level_progress"
+	MessageNotAvailable     = "not_available"
+	MessageDisabledTitle    = "disabled_title"
+	MessageDisabledSubtitle = "disabled_subtitle"
+)
+
+// The first language is used when none of the requested ones is supported.
+// Labels are measured with the embedded Go fonts, so only languages they have
+// glyphs for can be added.
+var supported = []language.Tag{
+	language.English,
+	language.French,
+	language.Spanish,
+	language.German,
+	language.Italian,
+	language.Portuguese,
+}
+
+// messages holds the labels of every supported language, keyed by base
+// language. Level progress takes the formatted level and percentage.
+var messages = map[string]map[string]string{
+	"en": {
+		MessageLevel:            "lvl",
+		MessageLevelProgress:    "Level %s (%s)",
+		MessageNotAvailable:     "N/A",
+		MessageDisabledTitle:    "Badge disabled",
+		MessageDisabledSubtitle: "This student opted out of badges.",
+	},
+	"fr": {
+		MessageLevel:            "niv.",
+		MessageLevelProgress:    "Niveau %s (%s)",
+		MessageNotAvailable:     "N/D",
+		MessageDisabledTitle:    "Badge désactivé",
+		MessageDisabledSubtitle: "Cette personne a désactivé son badge.",
+	},
+	"es": {
+		MessageLevel:            "nv.",
+		MessageLevelProgress:    "Nivel %s (%s)",
+		MessageNotAvailable:     "N/D",
+		MessageDisabledTitle:    "Insignia desactivada",
+		MessageDisabledSubtitle: "Esta persona ha desactivado su insignia.",
+	},
+	"de": {
+		MessageLevel:            "Lvl",
+		MessageLevelProgress:    "Level %s (%s)",
+		MessageNotAvailable:     "k. A.",
+		MessageDisabledTitle:    "Badge deaktiviert",
+		MessageDisabledSubtitle: "Diese Person hat ihr Badge deaktiviert.",
+	},
+	"it": {
+		MessageLevel:            "liv.",
+		MessageLevelProgress:    "Livello %s (%s)",
+		MessageNotAvailable:     "N/D",
+		MessageDisabledTitle:    "Badge disattivato",
+		MessageDisabledSubtitle: "Questa persona ha disattivato il proprio badge.",
+	},
+	"pt": {
+		MessageLevel:            "nív.",
+		MessageLevelProgress:    "Nível %s (%s)",
+		MessageNotAvailable:     "N/D",
+		MessageDisabledTitle:    "Badge desativado",
+		MessageDisabledSubtitle: "Esta pessoa desativou o seu badge.",
+	},
+}
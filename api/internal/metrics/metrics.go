@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ftbadge"
+
+var (
+	registry = prometheus.NewRegistry()
+
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	CacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Number of cache lookups by cache key and result (hit or miss).",
+	}, []string{"key", "result"})
+
+	IntraRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "intra_requests_total",
+		Help:      "Number of requests sent to the Intra API and CDN by operation and status code.",
+	}, []string{"operation", "status"})
+
+	IntraRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "intra_request_duration_seconds",
+		Help:      "Latency of requests sent to the Intra API and CDN by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	TokenRefreshes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_refreshes_total",
+		Help:      "Number of access tokens obtained from the Intra OAuth endpoint.",
+	})
+
+	RateLimitRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Number of requests rejected by a rate limiter by route.",
+	}, []string{"route"})
+
+	RenderDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "profile_render_duration_seconds",
+		Help:      "Time spent rendering a profile on a cache miss, including Intra requests.",
+		Buckets:   prometheus.DefBuckets,
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		CacheLookups,
+		IntraRequests,
+		IntraRequestDuration,
+		TokenRefreshes,
+		RateLimitRejections,
+		RenderDuration,
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+func StatusLabel(statusCode int) string {
+	return strconv.Itoa(statusCode)
+}
+
+func routeLabel(ctx echo.Context) string {
+	if route := ctx.Path(); route != "" {
+		return route
+	}
+	return "unmatched"
+}
+
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			start := time.Now()
+			err := next(ctx)
+
+			statusCode := ctx.Response().Status
+			if err != nil && !ctx.Response().Committed {
+				// The error response is written later by echo's error handler
+				statusCode = http.StatusInternalServerError
+				if httpError, ok := err.(*echo.HTTPError); ok {
+					statusCode = httpError.Code
+				}
+			}
+
+			route := routeLabel(ctx)
+			method := ctx.Request().Method
+			status := StatusLabel(statusCode)
+			HTTPRequests.WithLabelValues(route, method, status).Inc()
+			HTTPRequestDuration.WithLabelValues(route, method, status).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+func RecordRateLimitRejection(ctx echo.Context) {
+	RateLimitRejections.WithLabelValues(routeLabel(ctx)).Inc()
+}
@@ -0,0 +1,53 @@
+package privacy
+
+import (
+	"context"
+	"fmt"
+
+	"ftbadge/internal/state"
+)
+
+const optOutSet = "optouts"
+
+// Registry stores the logins of students who opted out of badges in a set of
+// the state store, so they are never evicted and each change is atomic.
+type Registry struct {
+	store state.Store
+}
+
+func NewRegistry(store state.Store) *Registry {
+	return &Registry{store: store}
+}
+
+func (r *Registry) OptedOut(ctx context.Context, login string) (bool, error) {
+	optedOut, err := r.store.IsMember(ctx, optOutSet, login)
+	if err != nil {
+		return false, fmt.Errorf("failed to check opt-out of %q: %w", login, err)
+	}
+	return optedOut, nil
+}
+
+// List returns the logins sorted.
+func (r *Registry) List(ctx context.Context) ([]string, error) {
+	logins, err := r.store.Members(ctx, optOutSet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list opt-outs: %w", err)
+	}
+	return logins, nil
+}
+
+func (r *Registry) OptOut(ctx context.Context, login string) error {
+	if err := r.store.AddMember(ctx, optOutSet, login); err != nil {
+		return fmt.Errorf("failed to save opt-out of %q: %w", login, err)
+	}
+	return nil
+}
+
+// OptIn returns false when the login had not opted out.
+func (r *Registry) OptIn(ctx context.Context, login string) (bool, error) {
+	removed, err := r.store.RemoveMember(ctx, optOutSet, login)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove opt-out of %q: %w", login, err)
+	}
+	return removed, nil
+}
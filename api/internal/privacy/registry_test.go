@@ -0,0 +1,44 @@
+package privacy
+
+import (
+	"slices"
+	"testing"
+
+	"ftbadge/internal/state"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry(state.NewMemoryStore())
+
+	for _, login := range []string{"testuser", "another", "testuser"} {
+		if err := registry.OptOut(t.Context(), login); err != nil {
+			t.Fatalf("Failed to opt out %q: %v", login, err)
+		}
+	}
+
+	logins, err := registry.List(t.Context())
+	if err != nil {
+		t.Fatalf("Failed to list opt-outs: %v", err)
+	}
+	if !slices.Equal(logins, []string{"another", "testuser"}) {
+		t.Fatalf("Unexpected opt-outs: %q", logins)
+	}
+
+	optedOut, err := registry.OptedOut(t.Context(), "testuser")
+	if err != nil || !optedOut {
+		t.Fatalf("Expected testuser to be opted out, got %v, %v", optedOut, err)
+	}
+
+	if optedIn, err := registry.OptIn(t.Context(), "testuser"); err != nil || !optedIn {
+		t.Fatalf("Failed to opt in testuser: %v", err)
+	}
+	if optedIn, err := registry.OptIn(t.Context(), "testuser"); err != nil || optedIn {
+		t.Fatalf("Expected opting in twice to report nothing changed, got %v, %v", optedIn, err)
+	}
+	if optedOut, _ := registry.OptedOut(t.Context(), "testuser"); optedOut {
+		t.Fatal("Expected testuser to be opted in")
+	}
+	if logins, _ := registry.List(t.Context()); !slices.Equal(logins, []string{"another"}) {
+		t.Fatalf("Unexpected opt-outs after opt in: %q", logins)
+	}
+}
@@ -0,0 +1,147 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/redis/go-redis/v9"
+
+	"ftbadge/internal/cache"
+	"ftbadge/internal/config"
+)
+
+// Minimum number of entries before the memory marker removes expired ones
+const minMarkerPrune = 1024
+
+// Marker remembers identifiers for a limited time.
+type Marker interface {
+	Seen(identifier string) (bool, error)
+	Mark(identifier string) error
+}
+
+type MemoryMarker struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	expiresIn time.Duration
+	nextPrune int
+	now       func() time.Time
+}
+
+func NewMemoryMarker(expiresIn time.Duration) *MemoryMarker {
+	return &MemoryMarker{seen: make(map[string]time.Time), expiresIn: expiresIn, nextPrune: minMarkerPrune, now: time.Now}
+}
+
+func (mm *MemoryMarker) Seen(identifier string) (bool, error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	expiresAt, found := mm.seen[identifier]
+	return found && mm.now().Before(expiresAt), nil
+}
+
+func (mm *MemoryMarker) Mark(identifier string) error {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	now := mm.now()
+	mm.seen[identifier] = now.Add(mm.expiresIn)
+	if len(mm.seen) < mm.nextPrune {
+		return nil
+	}
+
+	for seenIdentifier, expiresAt := range mm.seen {
+		if !now.Before(expiresAt) {
+			delete(mm.seen, seenIdentifier)
+		}
+	}
+	mm.nextPrune = max(2*len(mm.seen), minMarkerPrune)
+	return nil
+}
+
+type RedisMarker struct {
+	client    *redis.Client
+	prefix    string
+	expiresIn time.Duration
+}
+
+func NewRedisMarker(client *redis.Client, name string, expiresIn time.Duration) *RedisMarker {
+	return &RedisMarker{client, "ratelimit:" + name + ":seen:", expiresIn}
+}
+
+func (rm *RedisMarker) Seen(identifier string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	key := rm.prefix + identifier
+	count, err := rm.client.Exists(ctx, key).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check %q in Redis: %w", key, err)
+	}
+	return count == 1, nil
+}
+
+func (rm *RedisMarker) Mark(identifier string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	key := rm.prefix + identifier
+	if err := rm.client.Set(ctx, key, 1, rm.expiresIn).Err(); err != nil {
+		return fmt.Errorf("failed to set %q in Redis: %w", key, err)
+	}
+	return nil
+}
+
+// DistinctStore charges the budget of a client once for each distinct value
+// it uses within the expiry of the limiter, so repeating a value is free.
+type DistinctStore struct {
+	marker Marker
+	store  middleware.RateLimiterStore
+}
+
+func NewDistinctStore(marker Marker, store middleware.RateLimiterStore) *DistinctStore {
+	return &DistinctStore{marker, store}
+}
+
+func (ds *DistinctStore) Allow(client string, value string) (bool, error) {
+	identifier := client + ":" + value
+	seen, err := ds.marker.Seen(identifier)
+	if err != nil {
+		return false, err
+	}
+	if seen {
+		return true, nil
+	}
+
+	allowed, err := ds.store.Allow(client)
+	if err != nil || !allowed {
+		return false, err
+	}
+	// Only allowed values are remembered, so a denied value is charged again
+	if err := ds.marker.Mark(identifier); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// NewDistinctStoreFromConfig returns a distinct store backed by the store
+// selected in cfg.
+func NewDistinctStoreFromConfig(cfg config.RateLimitConfig, name string, limiter config.LimiterConfig, cc cache.CacheClient) (*DistinctStore, error) {
+	store, err := NewStore(cfg, name, limiter, cc)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Store {
+	case StoreRedis:
+		client, err := cache.SharedRedis(cc, "redis rate limiter store")
+		if err != nil {
+			return nil, err
+		}
+		return NewDistinctStore(NewRedisMarker(client, name, limiter.ExpiresIn), store), nil
+	default:
+		return NewDistinctStore(NewMemoryMarker(limiter.ExpiresIn), store), nil
+	}
+}
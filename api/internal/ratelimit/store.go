@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/time/rate"
+
+	"ftbadge/internal/cache"
+	"ftbadge/internal/config"
+)
+
+const (
+	StoreMemory = "memory"
+	StoreRedis  = "redis"
+)
+
+const redisTimeout = time.Second
+
+// gcraScript implements the generic cell rate algorithm. The key holds the
+// theoretical arrival time in milliseconds, read from the Redis clock so all
+// instances agree on the current time.
+var gcraScript = redis.NewScript(`
+local emission = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local tat = tonumber(redis.call("GET", KEYS[1]) or now)
+if tat < now then
+	tat = now
+end
+
+local newTat = tat + emission
+if now < newTat - burst * emission then
+	return 0
+end
+
+redis.call("SET", KEYS[1], newTat, "PX", math.ceil(newTat - now))
+return 1
+`)
+
+type RedisStore struct {
+	client   *redis.Client
+	prefix   string
+	emission float64
+	burst    int
+}
+
+func NewRedisStore(client *redis.Client, name string, cfg config.LimiterConfig) *RedisStore {
+	emission := float64(time.Second/time.Millisecond) / cfg.Rate
+	return &RedisStore{client, "ratelimit:" + name + ":", emission, cfg.Burst}
+}
+
+func (rs *RedisStore) Allow(identifier string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	key := rs.prefix + identifier
+	allowed, err := gcraScript.Run(ctx, rs.client, []string{key}, rs.emission, rs.burst).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate rate limit for %q in Redis: %w", key, err)
+	}
+	return allowed == 1, nil
+}
+
+func NewStore(cfg config.RateLimitConfig, name string, limiter config.LimiterConfig, cc cache.CacheClient) (middleware.RateLimiterStore, error) {
+	switch cfg.Store {
+	case StoreMemory:
+		return middleware.NewRateLimiterMemoryStoreWithConfig(
+			middleware.RateLimiterMemoryStoreConfig{Rate: rate.Limit(limiter.Rate), Burst: limiter.Burst, ExpiresIn: limiter.ExpiresIn},
+		), nil
+	case StoreRedis:
+		client, err := cache.SharedRedis(cc, "redis rate limiter store")
+		if err != nil {
+			return nil, err
+		}
+		return NewRedisStore(client, name, limiter), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limiter store %q", cfg.Store)
+	}
+}
@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"ftbadge/internal/config"
+)
+
+func TestRedisStoreSharesBudget(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.SetTime(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	limiter := config.LimiterConfig{Rate: 1, Burst: 3, ExpiresIn: time.Minute}
+	first := NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "profile", limiter)
+	second := NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "profile", limiter)
+
+	allow := func(store *RedisStore, identifier string) bool {
+		t.Helper()
+		allowed, err := store.Allow(identifier)
+		if err != nil {
+			t.Fatalf("Failed to evaluate rate limit: %v", err)
+		}
+		return allowed
+	}
+
+	for index, store := range []*RedisStore{first, second, first} {
+		if !allow(store, "203.0.113.1") {
+			t.Fatalf("Expected request %d within burst to be allowed", index)
+		}
+	}
+	if allow(second, "203.0.113.1") {
+		t.Fatal("Expected request over the shared burst to be denied")
+	}
+	if !allow(second, "203.0.113.2") {
+		t.Fatal("Expected another identifier to have its own budget")
+	}
+
+	server.SetTime(time.Date(2026, 1, 1, 0, 0, 1, 0, time.UTC))
+	if !allow(first, "203.0.113.1") {
+		t.Fatal("Expected a request to be allowed once a token was emitted")
+	}
+	if allow(first, "203.0.113.1") {
+		t.Fatal("Expected only one emitted token after a second")
+	}
+}
+
+func TestDistinctStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	limiter := config.LimiterConfig{Rate: 0.001, Burst: 2, ExpiresIn: time.Minute}
+
+	stores := map[string]*DistinctStore{
+		"memory": NewDistinctStore(NewMemoryMarker(limiter.ExpiresIn), NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "memory", limiter)),
+		"redis":  NewDistinctStore(NewRedisMarker(redis.NewClient(&redis.Options{Addr: server.Addr()}), "redis", limiter.ExpiresIn), NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "redis", limiter)),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			allow := func(client string, login string) bool {
+				t.Helper()
+				allowed, err := store.Allow(client, login)
+				if err != nil {
+					t.Fatalf("Failed to evaluate rate limit: %v", err)
+				}
+				return allowed
+			}
+
+			for _, login := range []string{"alice", "bob", "alice", "bob"} {
+				if !allow("ip:203.0.113.1", login) {
+					t.Fatalf("Expected %q within burst to be allowed", login)
+				}
+			}
+			if allow("ip:203.0.113.1", "carol") {
+				t.Fatal("Expected a third distinct login to be denied")
+			}
+			if allow("ip:203.0.113.1", "carol") {
+				t.Fatal("Expected a denied login to be charged again")
+			}
+			if !allow("ip:203.0.113.2", "carol") {
+				t.Fatal("Expected another client to have its own budget")
+			}
+		})
+	}
+}
+
+func TestMemoryMarkerExpiry(t *testing.T) {
+	marker := NewMemoryMarker(time.Minute)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	marker.now = func() time.Time { return now }
+
+	for index := range minMarkerPrune - 1 {
+		if err := marker.Mark(fmt.Sprint(index)); err != nil {
+			t.Fatalf("Failed to mark identifier: %v", err)
+		}
+	}
+	now = now.Add(time.Minute)
+	if seen, _ := marker.Seen("0"); seen {
+		t.Fatal("Expected the identifier to expire")
+	}
+
+	if err := marker.Mark("alice"); err != nil {
+		t.Fatalf("Failed to mark identifier: %v", err)
+	}
+	if size := len(marker.seen); size != 1 {
+		t.Fatalf("Expected expired identifiers to be pruned, got %d", size)
+	}
+}
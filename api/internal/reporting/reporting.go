@@ -0,0 +1,194 @@
+package reporting
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog"
+
+	"ftbadge/internal/config"
+)
+
+type Report struct {
+	Err            error
+	Login          string
+	RequestID      string
+	UpstreamStatus int
+}
+
+type Reporter interface {
+	Report(ctx context.Context, report Report)
+	Flush(timeout time.Duration)
+}
+
+// RequestScoper is implemented by reporters that keep a scope per request, so
+// that reports include the request and the breadcrumbs recorded while serving
+// it.
+type RequestScoper interface {
+	WithRequest(ctx context.Context, r *http.Request) context.Context
+}
+
+// AddBreadcrumb records a step of the request in its reporting scope, and does
+// nothing when the request has none.
+func AddBreadcrumb(ctx context.Context, category string, message string) {
+	if hub := sentry.GetHubFromContext(ctx); hub != nil {
+		hub.AddBreadcrumb(&sentry.Breadcrumb{Category: category, Message: message}, nil)
+	}
+}
+
+const (
+	ReporterSentry = "sentry"
+	ReporterLog    = "log"
+	ReporterNone   = "none"
+)
+
+var scrubPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`), "[email]"},
+	{regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/\-]+=*`), "${1}[token]"},
+	{regexp.MustCompile(`(?i)((?:access_token|refresh_token|client_secret|api_key|token)["']?\s*[:=]\s*["']?)[^"'&\s,}]+`), "${1}[redacted]"},
+}
+
+// Scrub removes email addresses and credentials from text sent to reporters.
+func Scrub(text string) string {
+	for _, scrub := range scrubPatterns {
+		text = scrub.pattern.ReplaceAllString(text, scrub.replacement)
+	}
+	return text
+}
+
+// New returns the reporter selected in cfg. Without an explicit choice Sentry
+// is used when a DSN is configured, otherwise errors are only logged.
+func New(cfg config.ReportingConfig, logger zerolog.Logger) (Reporter, error) {
+	reporter := cfg.Reporter
+	if reporter == "" {
+		reporter = ReporterLog
+		if cfg.SentryDSN != "" {
+			reporter = ReporterSentry
+		}
+	}
+
+	switch reporter {
+	case ReporterSentry:
+		return NewSentryReporter(cfg.SentryDSN)
+	case ReporterLog:
+		return NewLogReporter(logger), nil
+	case ReporterNone:
+		return NopReporter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown error reporter %q", reporter)
+	}
+}
+
+type NopReporter struct{}
+
+func (NopReporter) Report(ctx context.Context, report Report) {}
+func (NopReporter) Flush(timeout time.Duration)               {}
+
+type LogReporter struct {
+	logger zerolog.Logger
+}
+
+func NewLogReporter(logger zerolog.Logger) *LogReporter {
+	return &LogReporter{logger}
+}
+
+func (lr *LogReporter) Report(ctx context.Context, report Report) {
+	event := lr.logger.Error().
+		Str("login", report.Login).
+		Str("request_id", report.RequestID)
+	if report.UpstreamStatus != 0 {
+		event = event.Int("upstream_status", report.UpstreamStatus)
+	}
+	if report.Err != nil {
+		event = event.Str("error", Scrub(report.Err.Error()))
+	}
+	event.Msg("request failed")
+}
+
+func (lr *LogReporter) Flush(timeout time.Duration) {}
+
+type SentryReporter struct {
+	hub *sentry.Hub
+}
+
+func scrubEvent(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+	event.Message = Scrub(event.Message)
+	for index := range event.Exception {
+		event.Exception[index].Value = Scrub(event.Exception[index].Value)
+	}
+	for index := range event.Breadcrumbs {
+		event.Breadcrumbs[index].Message = Scrub(event.Breadcrumbs[index].Message)
+	}
+	if event.Request != nil {
+		event.Request.Cookies = ""
+		event.Request.QueryString = Scrub(event.Request.QueryString)
+		for name := range event.Request.Headers {
+			if isSensitiveHeader(name) {
+				delete(event.Request.Headers, name)
+			}
+		}
+	}
+	event.User = sentry.User{}
+	return event
+}
+
+// isSensitiveHeader matches credentials, including the configurable API key
+// header.
+func isSensitiveHeader(name string) bool {
+	name = strings.ToLower(name)
+	if name == "authorization" || name == "cookie" {
+		return true
+	}
+	return strings.Contains(name, "key") || strings.Contains(name, "token") || strings.Contains(name, "secret")
+}
+
+func NewSentryReporter(dsn string) (*SentryReporter, error) {
+	return newSentryReporter(sentry.ClientOptions{Dsn: dsn})
+}
+
+func newSentryReporter(options sentry.ClientOptions) (*SentryReporter, error) {
+	options.BeforeSend = scrubEvent
+	client, err := sentry.NewClient(options)
+	if err != nil {
+		return nil, fmt.Errorf("sentry initialization failed: %w", err)
+	}
+
+	hub := sentry.NewHub(client, sentry.NewScope())
+	return &SentryReporter{hub}, nil
+}
+
+// WithRequest returns a context holding a hub of its own, with the request in
+// its scope.
+func (sr *SentryReporter) WithRequest(ctx context.Context, r *http.Request) context.Context {
+	hub := sr.hub.Clone()
+	hub.Scope().SetRequest(r)
+	return sentry.SetHubOnContext(ctx, hub)
+}
+
+// Report uses the hub of the request when there is one.
+func (sr *SentryReporter) Report(ctx context.Context, report Report) {
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sr.hub
+	}
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetTag("login", report.Login)
+		scope.SetTag("request_id", report.RequestID)
+		if report.UpstreamStatus != 0 {
+			scope.SetContext("upstream", sentry.Context{"status": report.UpstreamStatus})
+		}
+		hub.CaptureException(report.Err)
+	})
+}
+
+func (sr *SentryReporter) Flush(timeout time.Duration) {
+	sr.hub.Flush(timeout)
+}
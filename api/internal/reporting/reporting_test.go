@@ -0,0 +1,131 @@
+package reporting
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog"
+
+	"ftbadge/internal/config"
+)
+
+func TestScrub(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"user testuser@student.42angouleme.fr not found", "user [email] not found"},
+		{"Authorization: Bearer abc.DEF-123_xyz=", "Authorization: Bearer [token]"},
+		{`{"access_token": "s3cr3t", "expires_in": 7200}`, `{"access_token": "[redacted]", "expires_in": 7200}`},
+		{"grant_type=client_credentials&client_secret=s-s4mple&client_id=u-abc", "grant_type=client_credentials&client_secret=[redacted]&client_id=u-abc"},
+		{"unexpected response status from user endpoint: 502 Bad Gateway", "unexpected response status from user endpoint: 502 Bad Gateway"},
+	}
+
+	for _, test := range tests {
+		if got := Scrub(test.input); got != test.expected {
+			t.Errorf("Scrub(%q) = %q, expected %q", test.input, got, test.expected)
+		}
+	}
+}
+
+func TestNewSelectsReporter(t *testing.T) {
+	logger := zerolog.Nop()
+
+	reporter, err := New(config.ReportingConfig{}, logger)
+	if _, ok := reporter.(*LogReporter); err != nil || !ok {
+		t.Fatalf("Expected log reporter without a DSN, got %T (%v)", reporter, err)
+	}
+
+	reporter, err = New(config.ReportingConfig{SentryDSN: "https://public@sentry.example.com/1"}, logger)
+	if _, ok := reporter.(*SentryReporter); err != nil || !ok {
+		t.Fatalf("Expected Sentry reporter with a DSN, got %T (%v)", reporter, err)
+	}
+
+	reporter, err = New(config.ReportingConfig{Reporter: ReporterNone, SentryDSN: "https://public@sentry.example.com/1"}, logger)
+	if _, ok := reporter.(NopReporter); err != nil || !ok {
+		t.Fatalf("Expected no-op reporter when explicitly selected, got %T (%v)", reporter, err)
+	}
+}
+
+func TestLogReporterScrubs(t *testing.T) {
+	buf := new(bytes.Buffer)
+	reporter := NewLogReporter(zerolog.New(buf))
+
+	reporter.Report(t.Context(), Report{
+		Err:            errors.New("failed to render testuser@student.42.fr"),
+		Login:          "testuser",
+		RequestID:      "request-id",
+		UpstreamStatus: 502,
+	})
+
+	output := buf.String()
+	if strings.Contains(output, "@student.42.fr") {
+		t.Fatalf("Expected email to be scrubbed, got %s", output)
+	}
+	for _, expected := range []string{`"login":"testuser"`, `"request_id":"request-id"`, `"upstream_status":502`} {
+		if !strings.Contains(output, expected) {
+			t.Fatalf("Expected %s in log output, got %s", expected, output)
+		}
+	}
+}
+
+type captureTransport struct {
+	mu     sync.Mutex
+	events []*sentry.Event
+}
+
+func (ct *captureTransport) Configure(options sentry.ClientOptions)    {}
+func (ct *captureTransport) Flush(timeout time.Duration) bool          { return true }
+func (ct *captureTransport) FlushWithContext(ctx context.Context) bool { return true }
+func (ct *captureTransport) Close()                                    {}
+func (ct *captureTransport) SendEvent(event *sentry.Event) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.events = append(ct.events, event)
+}
+
+func TestSentryReporterRequestScope(t *testing.T) {
+	transport := &captureTransport{}
+	reporter, err := newSentryReporter(sentry.ClientOptions{Dsn: "https://public@sentry.example.com/1", Transport: transport})
+	if err != nil {
+		t.Fatalf("Failed to create Sentry reporter: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/profile/testuser?lang=fr", nil)
+	req.Header.Set("X-API-Key", "secret-key")
+	ctx := reporter.WithRequest(t.Context(), req)
+	AddBreadcrumb(ctx, "intra", "user: 502 Bad Gateway")
+	otherCtx := reporter.WithRequest(t.Context(), httptest.NewRequest("GET", "/profile/other", nil))
+	AddBreadcrumb(otherCtx, "intra", "user: 200 OK")
+
+	reporter.Report(ctx, Report{Err: errors.New("failed to render"), Login: "testuser", RequestID: "request-id"})
+	reporter.Report(t.Context(), Report{Err: errors.New("failed outside a request")})
+
+	if len(transport.events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(transport.events))
+	}
+	event := transport.events[0]
+	if event.Request == nil || !strings.HasSuffix(event.Request.URL, "/profile/testuser") {
+		t.Fatalf("Expected the request in the event, got %+v", event.Request)
+	}
+	if _, found := event.Request.Headers["X-Api-Key"]; found {
+		t.Fatal("Expected the API key header to be scrubbed")
+	}
+	if len(event.Breadcrumbs) != 1 || event.Breadcrumbs[0].Message != "user: 502 Bad Gateway" {
+		t.Fatalf("Expected only the breadcrumb of the request, got %+v", event.Breadcrumbs)
+	}
+	if event.Tags["login"] != "testuser" || event.Tags["request_id"] != "request-id" {
+		t.Fatalf("Expected the report tags, got %v", event.Tags)
+	}
+
+	if unscoped := transport.events[1]; unscoped.Request != nil || len(unscoped.Breadcrumbs) != 0 {
+		t.Fatalf("Expected no request data outside a request, got %+v", unscoped.Request)
+	}
+}
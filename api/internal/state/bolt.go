@@ -0,0 +1,149 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltValuesBucket = []byte("values")
+	boltSetsBucket   = []byte("sets")
+)
+
+// BoltStore keeps each set in a nested bucket of the sets bucket.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state database %q: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltValuesBucket, boltSetsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create state buckets: %w", err)
+	}
+	return &BoltStore{db}, nil
+}
+
+func (bs *BoltStore) Close() error {
+	return bs.db.Close()
+}
+
+func (bs *BoltStore) Get(ctx context.Context, key string) (string, bool, error) {
+	var value string
+	var found bool
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltValuesBucket).Get([]byte(key))
+		value, found = string(data), data != nil
+		return nil
+	})
+	return value, found, err
+}
+
+func (bs *BoltStore) Set(ctx context.Context, key string, value string) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltValuesBucket).Put([]byte(key), []byte(value))
+	})
+}
+
+func (bs *BoltStore) Delete(ctx context.Context, key string) (bool, error) {
+	var deleted bool
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltValuesBucket)
+		deleted = bucket.Get([]byte(key)) != nil
+		return bucket.Delete([]byte(key))
+	})
+	return deleted, err
+}
+
+func (bs *BoltStore) Increment(ctx context.Context, deltas map[string]int64) (map[string]int64, error) {
+	values := make(map[string]int64, len(deltas))
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltValuesBucket)
+		for key, delta := range deltas {
+			var count int64
+			if data := bucket.Get([]byte(key)); data != nil {
+				var err error
+				if count, err = parseCounter(key, string(data)); err != nil {
+					return err
+				}
+			}
+			count += delta
+			if err := bucket.Put([]byte(key), strconv.AppendInt(nil, count, 10)); err != nil {
+				return err
+			}
+			values[key] = count
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func (bs *BoltStore) AddMember(ctx context.Context, set string, member string) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(boltSetsBucket).CreateBucketIfNotExists([]byte(set))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(member), []byte{})
+	})
+}
+
+func (bs *BoltStore) RemoveMember(ctx context.Context, set string, member string) (bool, error) {
+	var removed bool
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltSetsBucket).Bucket([]byte(set))
+		if bucket == nil {
+			return nil
+		}
+		removed = bucket.Get([]byte(member)) != nil
+		return bucket.Delete([]byte(member))
+	})
+	return removed, err
+}
+
+func (bs *BoltStore) IsMember(ctx context.Context, set string, member string) (bool, error) {
+	var found bool
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltSetsBucket).Bucket([]byte(set))
+		found = bucket != nil && bucket.Get([]byte(member)) != nil
+		return nil
+	})
+	return found, err
+}
+
+// Members are sorted, as bolt keeps keys in byte order.
+func (bs *BoltStore) Members(ctx context.Context, set string) ([]string, error) {
+	members := []string{}
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltSetsBucket).Bucket([]byte(set))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(member, _ []byte) error {
+			members = append(members, string(member))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
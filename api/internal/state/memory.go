@@ -0,0 +1,105 @@
+package state
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// MemoryStore is not durable, it is meant for tests.
+type MemoryStore struct {
+	mu     sync.Mutex
+	values map[string]string
+	sets   map[string]map[string]struct{}
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{values: make(map[string]string), sets: make(map[string]map[string]struct{})}
+}
+
+func (ms *MemoryStore) Get(ctx context.Context, key string) (string, bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	value, found := ms.values[key]
+	return value, found, nil
+}
+
+func (ms *MemoryStore) Set(ctx context.Context, key string, value string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.values[key] = value
+	return nil
+}
+
+func (ms *MemoryStore) Delete(ctx context.Context, key string) (bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	_, found := ms.values[key]
+	delete(ms.values, key)
+	return found, nil
+}
+
+func (ms *MemoryStore) Increment(ctx context.Context, deltas map[string]int64) (map[string]int64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	values := make(map[string]int64, len(deltas))
+	for key, delta := range deltas {
+		var count int64
+		if value, found := ms.values[key]; found {
+			var err error
+			if count, err = parseCounter(key, value); err != nil {
+				return nil, err
+			}
+		}
+		values[key] = count + delta
+	}
+	for key, count := range values {
+		ms.values[key] = strconv.FormatInt(count, 10)
+	}
+	return values, nil
+}
+
+func (ms *MemoryStore) AddMember(ctx context.Context, set string, member string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.sets[set] == nil {
+		ms.sets[set] = make(map[string]struct{})
+	}
+	ms.sets[set][member] = struct{}{}
+	return nil
+}
+
+func (ms *MemoryStore) RemoveMember(ctx context.Context, set string, member string) (bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	_, found := ms.sets[set][member]
+	delete(ms.sets[set], member)
+	return found, nil
+}
+
+func (ms *MemoryStore) IsMember(ctx context.Context, set string, member string) (bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	_, found := ms.sets[set][member]
+	return found, nil
+}
+
+func (ms *MemoryStore) Members(ctx context.Context, set string) ([]string, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	members := slices.Sorted(maps.Keys(ms.sets[set]))
+	if members == nil {
+		members = []string{}
+	}
+	return members, nil
+}
@@ -0,0 +1,87 @@
+package state
+
+import (
+	"context"
+	"slices"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore writes keys without expiry under the state prefix. The Redis
+// instance must not evict keys, so its maxmemory-policy has to be noeviction
+// or one of the volatile policies.
+type RedisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client}
+}
+
+func redisKey(key string) string {
+	return "state:" + key
+}
+
+func redisSetKey(set string) string {
+	return "state:set:" + set
+}
+
+func (rs *RedisStore) Get(ctx context.Context, key string) (string, bool, error) {
+	value, err := rs.client.Get(ctx, redisKey(key)).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+func (rs *RedisStore) Set(ctx context.Context, key string, value string) error {
+	return rs.client.Set(ctx, redisKey(key), value, 0).Err()
+}
+
+func (rs *RedisStore) Delete(ctx context.Context, key string) (bool, error) {
+	count, err := rs.client.Del(ctx, redisKey(key)).Result()
+	return count > 0, err
+}
+
+func (rs *RedisStore) Increment(ctx context.Context, deltas map[string]int64) (map[string]int64, error) {
+	cmds := make(map[string]*redis.IntCmd, len(deltas))
+	_, err := rs.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, delta := range deltas {
+			cmds[key] = pipe.IncrBy(ctx, redisKey(key), delta)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]int64, len(cmds))
+	for key, cmd := range cmds {
+		values[key] = cmd.Val()
+	}
+	return values, nil
+}
+
+func (rs *RedisStore) AddMember(ctx context.Context, set string, member string) error {
+	return rs.client.SAdd(ctx, redisSetKey(set), member).Err()
+}
+
+func (rs *RedisStore) RemoveMember(ctx context.Context, set string, member string) (bool, error) {
+	count, err := rs.client.SRem(ctx, redisSetKey(set), member).Result()
+	return count > 0, err
+}
+
+func (rs *RedisStore) IsMember(ctx context.Context, set string, member string) (bool, error) {
+	return rs.client.SIsMember(ctx, redisSetKey(set), member).Result()
+}
+
+func (rs *RedisStore) Members(ctx context.Context, set string) ([]string, error) {
+	members, err := rs.client.SMembers(ctx, redisSetKey(set)).Result()
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(members)
+	return members, nil
+}
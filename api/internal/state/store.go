@@ -0,0 +1,58 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"ftbadge/internal/cache"
+	"ftbadge/internal/config"
+)
+
+const (
+	StoreBolt  = "bolt"
+	StoreRedis = "redis"
+)
+
+const boltOpenTimeout = 5 * time.Second
+
+// Store persists state that must survive restarts and is never evicted, unlike
+// the cache. Values are plain keys and sets hold members without values. Get
+// returns false when the key does not exist, Delete and RemoveMember when
+// nothing was removed. Increment adds each delta to the counter of its key,
+// missing counters starting at zero, in a single atomic operation and returns
+// the new values. Counters are stored as decimal values.
+type Store interface {
+	Get(ctx context.Context, key string) (string, bool, error)
+	Set(ctx context.Context, key string, value string) error
+	Delete(ctx context.Context, key string) (bool, error)
+	Increment(ctx context.Context, deltas map[string]int64) (map[string]int64, error)
+	AddMember(ctx context.Context, set string, member string) error
+	RemoveMember(ctx context.Context, set string, member string) (bool, error)
+	IsMember(ctx context.Context, set string, member string) (bool, error)
+	Members(ctx context.Context, set string) ([]string, error)
+}
+
+func parseCounter(key string, value string) (int64, error) {
+	count, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode counter %q: %w", key, err)
+	}
+	return count, nil
+}
+
+func NewStore(cfg config.StateConfig, cc cache.CacheClient) (Store, error) {
+	switch cfg.Store {
+	case StoreBolt:
+		return NewBoltStore(cfg.Path)
+	case StoreRedis:
+		client, err := cache.SharedRedis(cc, "redis state store")
+		if err != nil {
+			return nil, err
+		}
+		return NewRedisStore(client), nil
+	default:
+		return nil, fmt.Errorf("unknown state store %q", cfg.Store)
+	}
+}
@@ -0,0 +1,117 @@
+package state
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestBoltStore(t *testing.T, path string) *BoltStore {
+	t.Helper()
+
+	store, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open bolt store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestStore(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		StoreBolt: func(t *testing.T) Store {
+			return newTestBoltStore(t, filepath.Join(t.TempDir(), "state.db"))
+		},
+		StoreRedis: func(t *testing.T) Store {
+			server := miniredis.RunT(t)
+			return NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+		},
+		"memory": func(t *testing.T) Store {
+			return NewMemoryStore()
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+
+			if _, found, err := store.Get(t.Context(), "preferences:testuser"); err != nil || found {
+				t.Fatalf("Expected a missing key, got %v, %v", found, err)
+			}
+			if err := store.Set(t.Context(), "preferences:testuser", `{"theme":"dark"}`); err != nil {
+				t.Fatalf("Failed to set key: %v", err)
+			}
+			if value, found, err := store.Get(t.Context(), "preferences:testuser"); err != nil || !found || value != `{"theme":"dark"}` {
+				t.Fatalf("Expected the stored value, got %q, %v, %v", value, found, err)
+			}
+			if deleted, err := store.Delete(t.Context(), "preferences:testuser"); err != nil || !deleted {
+				t.Fatalf("Expected the key to be deleted, got %v, %v", deleted, err)
+			}
+			if deleted, err := store.Delete(t.Context(), "preferences:testuser"); err != nil || deleted {
+				t.Fatalf("Expected deleting twice to report nothing deleted, got %v, %v", deleted, err)
+			}
+
+			if values, err := store.Increment(t.Context(), map[string]int64{"usage:today": 2, "usage:total": 5}); err != nil || values["usage:today"] != 2 || values["usage:total"] != 5 {
+				t.Fatalf("Expected counters to start at zero, got %v, %v", values, err)
+			}
+			if values, err := store.Increment(t.Context(), map[string]int64{"usage:today": 3}); err != nil || values["usage:today"] != 5 {
+				t.Fatalf("Expected the counter to be incremented, got %v, %v", values, err)
+			}
+			if value, found, err := store.Get(t.Context(), "usage:today"); err != nil || !found || value != "5" {
+				t.Fatalf("Expected the counter to be stored as a decimal value, got %q, %v, %v", value, found, err)
+			}
+			if err := store.Set(t.Context(), "preferences:other", `{"theme":"dark"}`); err != nil {
+				t.Fatalf("Failed to set key: %v", err)
+			}
+			if _, err := store.Increment(t.Context(), map[string]int64{"preferences:other": 1}); err == nil {
+				t.Fatal("Expected a value that is not a counter to be rejected")
+			}
+
+			if members, err := store.Members(t.Context(), "optouts"); err != nil || len(members) != 0 {
+				t.Fatalf("Expected an empty set, got %q, %v", members, err)
+			}
+			for _, login := range []string{"testuser", "another", "testuser"} {
+				if err := store.AddMember(t.Context(), "optouts", login); err != nil {
+					t.Fatalf("Failed to add member %q: %v", login, err)
+				}
+			}
+			if members, err := store.Members(t.Context(), "optouts"); err != nil || !slices.Equal(members, []string{"another", "testuser"}) {
+				t.Fatalf("Expected sorted members without duplicates, got %q, %v", members, err)
+			}
+			if found, err := store.IsMember(t.Context(), "optouts", "testuser"); err != nil || !found {
+				t.Fatalf("Expected testuser to be a member, got %v, %v", found, err)
+			}
+			if removed, err := store.RemoveMember(t.Context(), "optouts", "testuser"); err != nil || !removed {
+				t.Fatalf("Expected testuser to be removed, got %v, %v", removed, err)
+			}
+			if removed, err := store.RemoveMember(t.Context(), "optouts", "testuser"); err != nil || removed {
+				t.Fatalf("Expected removing twice to report nothing removed, got %v, %v", removed, err)
+			}
+			if removed, err := store.RemoveMember(t.Context(), "unknown", "testuser"); err != nil || removed {
+				t.Fatalf("Expected removing from an unknown set to report nothing removed, got %v, %v", removed, err)
+			}
+			if found, err := store.IsMember(t.Context(), "optouts", "testuser"); err != nil || found {
+				t.Fatalf("Expected testuser not to be a member, got %v, %v", found, err)
+			}
+		})
+	}
+}
+
+func TestBoltStoreSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	store := newTestBoltStore(t, path)
+	if err := store.AddMember(t.Context(), "optouts", "testuser"); err != nil {
+		t.Fatalf("Failed to add member: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Failed to close bolt store: %v", err)
+	}
+
+	reopened := newTestBoltStore(t, path)
+	if found, err := reopened.IsMember(t.Context(), "optouts", "testuser"); err != nil || !found {
+		t.Fatalf("Expected the member to survive a restart, got %v, %v", found, err)
+	}
+}
@@ -6,3 +6,6 @@ import (
 
 //go:embed profile.html
 var Profile string
+
+//go:embed disabled.html
+var Disabled string
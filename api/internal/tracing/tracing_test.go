@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"ftbadge/internal/config"
+)
+
+type collector struct {
+	mu    sync.Mutex
+	spans map[string]*tracepb.Span
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var request collectortrace.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	for _, resourceSpans := range request.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			for _, span := range scopeSpans.Spans {
+				c.spans[span.Name] = span
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	response, _ := proto.Marshal(&collectortrace.ExportTraceServiceResponse{})
+	w.Write(response)
+}
+
+func spanAttribute(span *tracepb.Span, key string) string {
+	for _, attribute := range span.Attributes {
+		if attribute.Key == key {
+			return attribute.Value.GetStringValue()
+		}
+	}
+	return ""
+}
+
+func TestOTLPExport(t *testing.T) {
+	received := &collector{spans: make(map[string]*tracepb.Span)}
+	collectorServer := httptest.NewServer(received)
+	defer collectorServer.Close()
+
+	shutdown, err := Setup(t.Context(), config.TracingConfig{
+		Exporter:    ExporterOTLP,
+		ServiceName: "ftbadge-test",
+		Endpoint:    collectorServer.URL,
+		SampleRatio: 1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to setup tracing: %v", err)
+	}
+
+	e := echo.New()
+	e.Use(middleware.RequestID())
+	e.Use(Middleware())
+	e.GET("/profile/:login", func(ctx echo.Context) error {
+		_, span := Start(ctx.Request().Context(), "profileHandler")
+		End(span, errors.New("intra unavailable"))
+		return ctx.String(http.StatusOK, TraceID(ctx.Request().Context()))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/profile/testuser", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if err := shutdown(t.Context()); err != nil {
+		t.Fatalf("Failed to shutdown tracing: %v", err)
+	}
+
+	received.mu.Lock()
+	defer received.mu.Unlock()
+
+	server, exists := received.spans["GET /profile/:login"]
+	if !exists {
+		t.Fatalf("Expected server span to be exported, got %v", received.spans)
+	}
+	requestID := rec.Header().Get(echo.HeaderXRequestID)
+	if got := spanAttribute(server, "http.request_id"); got == "" || got != requestID {
+		t.Fatalf("Expected server span request ID %q, got %q", requestID, got)
+	}
+
+	handler, exists := received.spans["profileHandler"]
+	if !exists {
+		t.Fatalf("Expected handler span to be exported, got %v", received.spans)
+	}
+	if string(handler.ParentSpanId) != string(server.SpanId) {
+		t.Fatal("Expected handler span to be a child of the server span")
+	}
+	if handler.Status.GetCode() != tracepb.Status_STATUS_CODE_ERROR {
+		t.Fatalf("Expected handler span to have an error status, got %v", handler.Status)
+	}
+
+	traceID := hex.EncodeToString(server.TraceId)
+	if got := rec.Body.String(); got != traceID {
+		t.Fatalf("Expected trace ID %q in response, got %q", traceID, got)
+	}
+}
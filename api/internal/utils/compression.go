@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"bytes"
 	"compress/gzip"
 	"fmt"
 	"io"
@@ -20,3 +21,17 @@ func DecompressGzip(input io.Reader) ([]byte, error) {
 
 	return data, nil
 }
+
+func CompressGzip(data []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	gzipWriter := gzip.NewWriter(buf)
+
+	if _, err := gzipWriter.Write(data); err != nil {
+		return nil, fmt.Errorf("error writing gzip data: %w", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close gzip writer: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+)
+
+const (
+	// Images are sampled on a grid of at most cropSamples by cropSamples
+	cropSamples = 64
+	// Below this share of skin pixels, the image is assumed to have no face
+	minSkinRatio = 0.02
+	// Faces are placed slightly above the center of the crop to keep the chin
+	// and shoulders
+	faceAnchor = 0.45
+	// Portraits without a face are cropped from the upper third
+	portraitBias = 1.0 / 3
+)
+
+// isSkin is a common YCbCr skin tone rule. It covers most skin tones under
+// normal lighting while rejecting dark and saturated backgrounds.
+func isSkin(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	y, cb, cr := color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(b>>8)) // #nosec G115 -- RGBA returns 16-bit values
+	return y >= 40 && y <= 240 && cb >= 77 && cb <= 127 && cr >= 133 && cr <= 173
+}
+
+// skinCentroid returns the center of the skin pixels of img relative to its
+// bounds, or false when there are too few of them.
+func skinCentroid(img image.Image) (float64, float64, bool) {
+	bounds := img.Bounds()
+	step := max(1, max(bounds.Dx(), bounds.Dy())/cropSamples)
+
+	var sumX, sumY float64
+	var skin, samples int
+	for y := bounds.Min.Y + step/2; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X + step/2; x < bounds.Max.X; x += step {
+			samples++
+			if isSkin(img.At(x, y)) {
+				skin++
+				sumX += float64(x - bounds.Min.X)
+				sumY += float64(y - bounds.Min.Y)
+			}
+		}
+	}
+	if samples == 0 || float64(skin)/float64(samples) < minSkinRatio {
+		return 0, 0, false
+	}
+	return sumX / float64(skin), sumY / float64(skin), true
+}
+
+func clampOffset(offset float64, maxOffset int) int {
+	return max(0, min(int(offset), maxOffset))
+}
+
+// subjectCrop returns the square of img to keep, placed around the skin pixels
+// when there are enough of them.
+func subjectCrop(img image.Image) image.Rectangle {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	size := min(width, height)
+	maxX, maxY := width-size, height-size
+
+	xOffset, yOffset := maxX/2, int(float64(maxY)*portraitBias)
+	if centerX, centerY, found := skinCentroid(img); found {
+		xOffset = clampOffset(centerX-float64(size)/2, maxX)
+		yOffset = clampOffset(centerY-float64(size)*faceAnchor, maxY)
+	}
+	return image.Rect(xOffset, yOffset, xOffset+size, yOffset+size).Add(bounds.Min)
+}
+
+// CropToSubject crops img to a square that keeps the face of the avatar,
+// found with a skin tone heuristic. Portraits without a detected face are
+// cropped from their upper third, where heads usually are, instead of their
+// center.
+func CropToSubject(img image.Image) image.Image {
+	return crop(img, subjectCrop(img))
+}
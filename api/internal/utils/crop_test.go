@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+var (
+	backgroundColor = color.RGBA{40, 70, 140, 255}
+	skinColor       = color.RGBA{224, 172, 138, 255}
+	darkSkinColor   = color.RGBA{141, 85, 60, 255}
+)
+
+// syntheticImage returns a uniform background with a face drawn as an ellipse
+// centered on face, or no face when face is the zero point.
+func syntheticImage(width int, height int, face image.Point, skin color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(backgroundColor), image.Point{}, draw.Src)
+	if face == (image.Point{}) {
+		return img
+	}
+
+	radiusX, radiusY := width/8, width/6
+	for y := face.Y - radiusY; y <= face.Y+radiusY; y++ {
+		for x := face.X - radiusX; x <= face.X+radiusX; x++ {
+			dx, dy := float64(x-face.X)/float64(radiusX), float64(y-face.Y)/float64(radiusY)
+			if dx*dx+dy*dy <= 1 {
+				img.Set(x, y, skin)
+			}
+		}
+	}
+	return img
+}
+
+func TestSubjectCrop(t *testing.T) {
+	tests := []struct {
+		name     string
+		img      image.Image
+		face     image.Point
+		expected image.Point
+	}{
+		{"portrait without face", syntheticImage(300, 600, image.Point{}, nil), image.Point{}, image.Pt(0, 100)},
+		{"landscape without face", syntheticImage(600, 300, image.Point{}, nil), image.Point{}, image.Pt(150, 0)},
+		{"square", syntheticImage(300, 300, image.Pt(150, 80), skinColor), image.Pt(150, 80), image.Pt(0, 0)},
+		{"portrait with face at the top", syntheticImage(300, 600, image.Pt(150, 90), skinColor), image.Pt(150, 90), image.Pt(0, 0)},
+		{"portrait with face in the middle", syntheticImage(300, 600, image.Pt(150, 330), darkSkinColor), image.Pt(150, 330), image.Pt(0, 195)},
+		{"landscape with face on the right", syntheticImage(600, 300, image.Pt(480, 150), skinColor), image.Pt(480, 150), image.Pt(300, 0)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rect := subjectCrop(test.img)
+			size := min(test.img.Bounds().Dx(), test.img.Bounds().Dy())
+			if rect.Dx() != size || rect.Dy() != size {
+				t.Fatalf("Expected a %dx%d crop, got %v", size, size, rect)
+			}
+			if !rect.In(test.img.Bounds()) {
+				t.Fatalf("Expected the crop to stay inside the image, got %v", rect)
+			}
+			if test.face != (image.Point{}) && !test.face.In(rect) {
+				t.Fatalf("Expected the face at %v to be kept, got %v", test.face, rect)
+			}
+
+			// Allow for the sampling grid
+			delta := rect.Min.Sub(test.expected)
+			if delta.X < -10 || delta.X > 10 || delta.Y < -10 || delta.Y > 10 {
+				t.Fatalf("Expected the crop to start near %v, got %v", test.expected, rect.Min)
+			}
+		})
+	}
+}
+
+func TestCropToSubject(t *testing.T) {
+	img := syntheticImage(300, 600, image.Pt(150, 90), skinColor)
+	cropped := CropToSubject(img)
+	if bounds := cropped.Bounds(); bounds.Dx() != 300 || bounds.Dy() != 300 {
+		t.Fatalf("Expected a 300x300 avatar, got %v", bounds)
+	}
+	if !isSkin(cropped.At(150, 90)) {
+		t.Fatal("Expected the face to be visible in the cropped avatar")
+	}
+}
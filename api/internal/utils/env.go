@@ -1,22 +0,0 @@
-package utils
-
-import (
-	"fmt"
-	"os"
-)
-
-func MustGetEnv(key string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		panic(fmt.Sprintf("environment variable %q is not set", key))
-	}
-	return value
-}
-
-func GetEnvWithDefault(key string, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
-	}
-	return value
-}
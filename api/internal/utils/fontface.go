@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/ristretto/v2"
+)
+
+// Families of the fonts embedded in SVGs. Templates list them first and keep
+// a generic family as fallback for glyphs missing from the Go fonts.
+const (
+	FontFamily     = "ftbadge"
+	FontFamilyMono = "ftbadge-mono"
+)
+
+type fontFace struct {
+	family string
+	weight string
+	font   *Font
+}
+
+// fontFaces are ordered like they are declared. Sans faces cover weight
+// ranges so that semi-bold text uses the medium font instead of the bold one.
+var fontFaces = []fontFace{
+	{FontFamily, "1 450", SansFont},
+	{FontFamily, "451 650", SansMediumFont},
+	{FontFamily, "651 1000", SansBoldFont},
+	{FontFamilyMono, "1 1000", MonoFont},
+}
+
+var subsetCache = mustNewSubsetCache()
+
+func mustNewSubsetCache() *ristretto.Cache[string, string] {
+	cache, err := ristretto.NewCache(&ristretto.Config[string, string]{
+		NumCounters: 1e4,
+		MaxCost:     16 << 20,
+		BufferItems: 64,
+	})
+	if err != nil {
+		panic(fmt.Sprintf("failed to create font subset cache: %v", err))
+	}
+	return cache
+}
+
+func parseFontWeight(weight string) int {
+	switch weight {
+	case "", "normal":
+		return 400
+	case "bold":
+		return 700
+	}
+	value, err := strconv.Atoi(weight)
+	if err != nil {
+		return 400
+	}
+	return value
+}
+
+func selectFont(family string, weight int) *Font {
+	families := strings.Split(family, ",")
+	switch strings.TrimSpace(families[0]) {
+	case FontFamilyMono:
+		return MonoFont
+	case FontFamily:
+		switch {
+		case weight <= 450:
+			return SansFont
+		case weight <= 650:
+			return SansMediumFont
+		default:
+			return SansBoldFont
+		}
+	}
+	return nil
+}
+
+type textStyle struct {
+	family string
+	weight int
+}
+
+// collectText returns the text drawn with each embedded font, following the
+// font-family and font-weight attributes inherited by text and tspan elements.
+func collectText(svg []byte) (map[*Font]string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(svg))
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+
+	texts := make(map[*Font]string)
+	var styles []textStyle
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return texts, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SVG: %w", err)
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			if element.Name.Local != "text" && element.Name.Local != "tspan" {
+				continue
+			}
+			style := textStyle{weight: 400}
+			if len(styles) > 0 {
+				style = styles[len(styles)-1]
+			}
+			for _, attr := range element.Attr {
+				switch attr.Name.Local {
+				case "font-family":
+					style.family = attr.Value
+				case "font-weight":
+					style.weight = parseFontWeight(attr.Value)
+				}
+			}
+			styles = append(styles, style)
+		case xml.EndElement:
+			if (element.Name.Local == "text" || element.Name.Local == "tspan") && len(styles) > 0 {
+				styles = styles[:len(styles)-1]
+			}
+		case xml.CharData:
+			if len(styles) == 0 {
+				continue
+			}
+			style := styles[len(styles)-1]
+			if font := selectFont(style.family, style.weight); font != nil {
+				texts[font] += string(element)
+			}
+		}
+	}
+}
+
+func glyphSetKey(f *Font, text string) string {
+	glyphs := f.Glyphs(text)
+	key := make([]string, len(glyphs))
+	for index, glyph := range glyphs {
+		key[index] = strconv.Itoa(int(glyph))
+	}
+	return f.name + ":" + strings.Join(key, ",")
+}
+
+// subsetBase64 returns the base64 encoded subset of f for text. Subsets are
+// cached by glyph set, so texts sharing the same glyphs share the subset.
+func subsetBase64(f *Font, text string) (string, error) {
+	key := glyphSetKey(f, text)
+	if subset, exists := subsetCache.Get(key); exists {
+		return subset, nil
+	}
+
+	data, err := f.Subset(text)
+	if err != nil {
+		return "", err
+	}
+	subset := base64.StdEncoding.EncodeToString(data)
+	subsetCache.Set(key, subset, int64(len(key)+len(subset)))
+	return subset, nil
+}
+
+// EmbedFonts adds @font-face rules with subsets of the embedded fonts used by
+// the text of svg, so badges look the same on every platform.
+func EmbedFonts(svg []byte) ([]byte, error) {
+	texts, err := collectText(svg)
+	if err != nil {
+		return nil, err
+	}
+
+	var style strings.Builder
+	for _, face := range fontFaces {
+		text := texts[face.font]
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		subset, err := subsetBase64(face.font, text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to subset font %q: %w", face.font.name, err)
+		}
+		fmt.Fprintf(&style, "@font-face{font-family:%s;font-weight:%s;src:url(data:font/ttf;base64,%s) format(\"truetype\")}", face.family, face.weight, subset)
+	}
+	if style.Len() == 0 {
+		return svg, nil
+	}
+
+	start := bytes.Index(svg, []byte("<svg"))
+	end := bytes.IndexByte(svg[max(start, 0):], '>')
+	if start < 0 || end < 0 {
+		return nil, fmt.Errorf("failed to find the svg element")
+	}
+	insert := start + end + 1
+	return slices.Concat(svg[:insert], []byte("<style>"), []byte(style.String()), []byte("</style>"), svg[insert:]), nil
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+const (
+	identiconCells = 5
+	// Cells are drawn inside a margin of about one cell on each side
+	identiconGrid = identiconCells + 2
+)
+
+var identiconBackground = color.RGBA{0x21, 0x26, 0x2d, 0xff}
+
+// hslToRGB converts a hue in degrees with saturation and lightness in [0, 1].
+func hslToRGB(hue float64, saturation float64, lightness float64) color.RGBA {
+	chroma := (1 - math.Abs(2*lightness-1)) * saturation
+	x := chroma * (1 - math.Abs(math.Mod(hue/60, 2)-1))
+	m := lightness - chroma/2
+
+	var r, g, b float64
+	switch {
+	case hue < 60:
+		r, g = chroma, x
+	case hue < 120:
+		r, g = x, chroma
+	case hue < 180:
+		g, b = chroma, x
+	case hue < 240:
+		g, b = x, chroma
+	case hue < 300:
+		r, b = x, chroma
+	default:
+		r, b = chroma, x
+	}
+	channel := func(value float64) uint8 { return uint8(math.Round((value + m) * 255)) }
+	return color.RGBA{channel(r), channel(g), channel(b), 0xff}
+}
+
+// Identicon returns a deterministic, horizontally symmetric 5x5 pattern of
+// size pixels derived from seed.
+func Identicon(seed string, size int) image.Image {
+	hash := sha256.Sum256([]byte(seed))
+	hue := float64(uint16(hash[0])<<8|uint16(hash[1])) / 65536 * 360
+	foreground := hslToRGB(hue, 0.55, 0.6)
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(identiconBackground), image.Point{}, draw.Src)
+
+	cellSize := size / identiconGrid
+	margin := (size - identiconCells*cellSize) / 2
+
+	bit := 0
+	for column := range (identiconCells + 1) / 2 {
+		for row := range identiconCells {
+			filled := hash[2+bit/8]&(1<<(bit%8)) != 0
+			bit++
+			if !filled {
+				continue
+			}
+			for _, x := range []int{column, identiconCells - 1 - column} {
+				cell := image.Rect(margin+x*cellSize, margin+row*cellSize, margin+(x+1)*cellSize, margin+(row+1)*cellSize)
+				draw.Draw(img, cell, image.NewUniform(foreground), image.Point{}, draw.Src)
+			}
+		}
+	}
+	return img
+}
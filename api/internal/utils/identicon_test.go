@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestIdenticon(t *testing.T) {
+	const size = 200
+
+	first, err := EncodeToPNG(Identicon("testuser", size))
+	if err != nil {
+		t.Fatalf("Failed to encode identicon: %v", err)
+	}
+	second, err := EncodeToPNG(Identicon("testuser", size))
+	if err != nil {
+		t.Fatalf("Failed to encode identicon: %v", err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Fatal("Expected identicons of the same login to be identical")
+	}
+
+	other, err := EncodeToPNG(Identicon("otheruser", size))
+	if err != nil {
+		t.Fatalf("Failed to encode identicon: %v", err)
+	}
+	if bytes.Equal(first, other) {
+		t.Fatal("Expected identicons of different logins to differ")
+	}
+
+	img := Identicon("testuser", size)
+	if bounds := img.Bounds(); bounds.Dx() != size || bounds.Dy() != size {
+		t.Fatalf("Expected a %dx%d identicon, got %v", size, size, bounds)
+	}
+	for y := range size {
+		for x := range size / 2 {
+			if img.At(x, y) != img.At(size-1-x, y) {
+				t.Fatalf("Expected a symmetric identicon, pixel %d,%d differs", x, y)
+			}
+		}
+	}
+}
@@ -7,6 +7,10 @@ import (
 	"image"
 	"image/draw"
 	"image/jpeg"
+	"image/png"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
 )
 
 func CropToSquare(img image.Image) image.Image {
@@ -16,14 +20,28 @@ func CropToSquare(img image.Image) image.Image {
 
 	xOffset := (width - size) / 2
 	yOffset := (height - size) / 2
-	cropRect := image.Rect(xOffset, yOffset, xOffset+size, yOffset+size)
+	return crop(img, image.Rect(xOffset, yOffset, xOffset+size, yOffset+size).Add(bounds.Min))
+}
 
-	square := image.NewRGBA(image.Rect(0, 0, size, size))
+func crop(img image.Image, cropRect image.Rectangle) image.Image {
+	square := image.NewRGBA(image.Rect(0, 0, cropRect.Dx(), cropRect.Dy()))
 	draw.Draw(square, square.Bounds(), img, cropRect.Min, draw.Src)
-
 	return square
 }
 
+// ResizeSquare crops img to a square around its subject and downscales it to size pixels with a
+// Catmull-Rom filter. Smaller images are only cropped.
+func ResizeSquare(img image.Image, size int) image.Image {
+	square := CropToSubject(img)
+	if square.Bounds().Dx() <= size {
+		return square
+	}
+
+	resized := image.NewRGBA(image.Rect(0, 0, size, size))
+	xdraw.CatmullRom.Scale(resized, resized.Bounds(), square, square.Bounds(), xdraw.Src, nil)
+	return resized
+}
+
 func EncodeToJPEG(img image.Image, quality int) ([]byte, error) {
 	opt := jpeg.Options{
 		Quality: quality,
@@ -36,7 +54,36 @@ func EncodeToJPEG(img image.Image, quality int) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+func EncodeToPNG(img image.Image) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return nil, fmt.Errorf("PNG encoding failed: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
 func JPEGBytesToDataURI(jpegData []byte) (string, error) {
-	base64Data := base64.StdEncoding.EncodeToString(jpegData)
-	return "data:image/jpeg;base64," + base64Data, nil
+	return BytesToDataURI("image/jpeg", jpegData), nil
+}
+
+func BytesToDataURI(mimeType string, data []byte) string {
+	base64Data := base64.StdEncoding.EncodeToString(data)
+	return "data:" + mimeType + ";base64," + base64Data
+}
+
+func DataURIToBytes(dataURI string) (string, []byte, error) {
+	rest, found := strings.CutPrefix(dataURI, "data:")
+	if !found {
+		return "", nil, fmt.Errorf("data URI is missing the \"data:\" scheme")
+	}
+	mimeType, base64Data, found := strings.Cut(rest, ";base64,")
+	if !found {
+		return "", nil, fmt.Errorf("data URI is not base64 encoded")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(base64Data)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode data URI payload: %w", err)
+	}
+	return mimeType, data, nil
 }
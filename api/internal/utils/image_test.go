@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"math/rand/v2"
+	"testing"
+)
+
+// photoImage returns a smooth gradient with some noise, which compresses like
+// a photo rather than like random pixels.
+func photoImage(width int, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			noise := rand.IntN(24)
+			img.Set(x, y, color.RGBA{
+				uint8((x*255/width + noise) % 256),  // #nosec G115 -- bounded by the modulo
+				uint8((y*255/height + noise) % 256), // #nosec G115 -- bounded by the modulo
+				uint8((x + y + noise) % 256),        // #nosec G115 -- bounded by the modulo
+				255,
+			})
+		}
+	}
+	return img
+}
+
+func TestResizeSquare(t *testing.T) {
+	tests := []struct {
+		name     string
+		width    int
+		height   int
+		expected int
+	}{
+		{"portrait", 480, 600, 200},
+		{"landscape", 600, 300, 200},
+		{"small", 150, 120, 120},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bounds := ResizeSquare(photoImage(test.width, test.height), 200).Bounds()
+			if bounds.Dx() != test.expected || bounds.Dy() != test.expected {
+				t.Fatalf("Expected a %dx%d avatar, got %dx%d", test.expected, test.expected, bounds.Dx(), bounds.Dy())
+			}
+		})
+	}
+}
+
+// BenchmarkAvatarPayload reports the size of the data URI embedded in badges
+// for a medium Intra avatar, before and after resizing it.
+func BenchmarkAvatarPayload(b *testing.B) {
+	img := photoImage(480, 600)
+
+	benchmarks := []struct {
+		name      string
+		transform func(image.Image) image.Image
+	}{
+		{"cropped", CropToSquare},
+		{"resized", func(img image.Image) image.Image { return ResizeSquare(img, 200) }},
+	}
+
+	for _, benchmark := range benchmarks {
+		b.Run(benchmark.name, func(b *testing.B) {
+			var payload int
+			for b.Loop() {
+				data, err := EncodeToJPEG(benchmark.transform(img), 70)
+				if err != nil {
+					b.Fatalf("Failed to encode avatar: %v", err)
+				}
+				payload = len(BytesToDataURI("image/jpeg", data))
+			}
+			b.ReportMetric(float64(payload), "payload-bytes")
+		})
+	}
+}
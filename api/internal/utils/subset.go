@@ -0,0 +1,466 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"sort"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+const (
+	compositeArgsAreWords   = 0x0001
+	compositeHaveScale      = 0x0008
+	compositeMoreComponents = 0x0020
+	compositeHaveXYScale    = 0x0040
+	compositeHaveTwoByTwo   = 0x0080
+	compositeHaveInstrs     = 0x0100
+
+	nameIDLicense   = 13
+	namePlatformMac = 1
+)
+
+// Glyphs returns the sorted glyph indices used by the runes of text, always
+// including the .notdef glyph.
+func (f *Font) Glyphs(text string) []sfnt.GlyphIndex {
+	var buf sfnt.Buffer
+	glyphs := []sfnt.GlyphIndex{0}
+	for _, r := range text {
+		if index, err := f.font.GlyphIndex(&buf, r); err == nil && index != 0 {
+			glyphs = append(glyphs, index)
+		}
+	}
+	slices.Sort(glyphs)
+	return slices.Compact(glyphs)
+}
+
+type fontTables map[string][]byte
+
+// requiredTables maps the tables kept in subsets to the length of the fields
+// read from them.
+var requiredTables = map[string]int{
+	"cmap": 0,
+	"glyf": 0,
+	"head": 54,
+	"hhea": 36,
+	"hmtx": 4,
+	"loca": 0,
+	"maxp": 6,
+	"name": 6,
+	"post": 32,
+}
+
+func parseTables(data []byte) (fontTables, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("font is too short")
+	}
+	count := int(binary.BigEndian.Uint16(data[4:]))
+	if len(data) < 12+16*count {
+		return nil, fmt.Errorf("font table directory is truncated")
+	}
+
+	tables := make(fontTables, count)
+	for index := range count {
+		record := data[12+16*index:]
+		offset := int(binary.BigEndian.Uint32(record[8:]))
+		length := int(binary.BigEndian.Uint32(record[12:]))
+		if offset+length > len(data) {
+			return nil, fmt.Errorf("font table %q is out of bounds", record[:4])
+		}
+		tables[string(record[:4])] = data[offset : offset+length]
+	}
+
+	for tag, length := range requiredTables {
+		if len(tables[tag]) < length {
+			return nil, fmt.Errorf("font table %q is missing or truncated", tag)
+		}
+	}
+	return tables, nil
+}
+
+func (t fontTables) glyphOffsets() ([]int, error) {
+	numGlyphs := int(binary.BigEndian.Uint16(t["maxp"][4:]))
+	longFormat := binary.BigEndian.Uint16(t["head"][50:]) == 1
+	loca := t["loca"]
+
+	offsets := make([]int, numGlyphs+1)
+	for index := range offsets {
+		if longFormat {
+			if len(loca) < 4*(index+1) {
+				return nil, fmt.Errorf("loca table is truncated")
+			}
+			offsets[index] = int(binary.BigEndian.Uint32(loca[4*index:]))
+		} else {
+			if len(loca) < 2*(index+1) {
+				return nil, fmt.Errorf("loca table is truncated")
+			}
+			offsets[index] = 2 * int(binary.BigEndian.Uint16(loca[2*index:]))
+		}
+	}
+	return offsets, nil
+}
+
+func (t fontTables) glyph(offsets []int, index sfnt.GlyphIndex) ([]byte, error) {
+	if int(index)+1 >= len(offsets) {
+		return nil, fmt.Errorf("glyph %d is out of range", index)
+	}
+	start, end := offsets[index], offsets[index+1]
+	if start > end || end > len(t["glyf"]) {
+		return nil, fmt.Errorf("glyph %d is out of bounds", index)
+	}
+	return t["glyf"][start:end], nil
+}
+
+// walkComponents calls fn with the offset of the glyph index of every component
+// of a composite glyph and returns the end of the component records.
+func walkComponents(glyph []byte, fn func(offset int)) (int, uint16, error) {
+	offset := 10
+	for {
+		if len(glyph) < offset+4 {
+			return 0, 0, fmt.Errorf("composite glyph is truncated")
+		}
+		flags := binary.BigEndian.Uint16(glyph[offset:])
+		fn(offset + 2)
+
+		offset += 4
+		if flags&compositeArgsAreWords != 0 {
+			offset += 4
+		} else {
+			offset += 2
+		}
+		switch {
+		case flags&compositeHaveScale != 0:
+			offset += 2
+		case flags&compositeHaveXYScale != 0:
+			offset += 4
+		case flags&compositeHaveTwoByTwo != 0:
+			offset += 8
+		}
+		if flags&compositeMoreComponents == 0 {
+			if len(glyph) < offset {
+				return 0, 0, fmt.Errorf("composite glyph is truncated")
+			}
+			return offset, flags, nil
+		}
+	}
+}
+
+// glyphClosure adds the components of composite glyphs to glyphs.
+func (t fontTables) glyphClosure(offsets []int, glyphs []sfnt.GlyphIndex) ([]sfnt.GlyphIndex, error) {
+	pending := slices.Clone(glyphs)
+	for len(pending) > 0 {
+		index := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		glyph, err := t.glyph(offsets, index)
+		if err != nil {
+			return nil, err
+		}
+		if len(glyph) < 10 || int16(binary.BigEndian.Uint16(glyph)) >= 0 {
+			continue
+		}
+		_, _, err = walkComponents(glyph, func(offset int) {
+			component := sfnt.GlyphIndex(binary.BigEndian.Uint16(glyph[offset:]))
+			if !slices.Contains(glyphs, component) {
+				glyphs = append(glyphs, component)
+				pending = append(pending, component)
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read glyph %d: %w", index, err)
+		}
+	}
+	slices.Sort(glyphs)
+	return glyphs, nil
+}
+
+// rewriteGlyph drops the hinting instructions of a glyph, since the hinting
+// tables are not kept, and renumbers the components of composite glyphs.
+func rewriteGlyph(glyph []byte, remap map[sfnt.GlyphIndex]uint16) ([]byte, error) {
+	if len(glyph) == 0 {
+		return nil, nil
+	}
+	if len(glyph) < 10 {
+		return nil, fmt.Errorf("glyph header is truncated")
+	}
+
+	contours := int(int16(binary.BigEndian.Uint16(glyph)))
+	if contours >= 0 {
+		offset := 10 + 2*contours
+		if len(glyph) < offset+2 {
+			return nil, fmt.Errorf("simple glyph is truncated")
+		}
+		instructions := int(binary.BigEndian.Uint16(glyph[offset:]))
+		if len(glyph) < offset+2+instructions {
+			return nil, fmt.Errorf("simple glyph instructions are truncated")
+		}
+		rewritten := slices.Clone(glyph[:offset])
+		rewritten = append(rewritten, 0, 0)
+		return append(rewritten, glyph[offset+2+instructions:]...), nil
+	}
+
+	rewritten := slices.Clone(glyph)
+	var last int
+	end, flags, err := walkComponents(rewritten, func(offset int) {
+		component := sfnt.GlyphIndex(binary.BigEndian.Uint16(rewritten[offset:]))
+		binary.BigEndian.PutUint16(rewritten[offset:], remap[component])
+		last = offset - 2
+	})
+	if err != nil {
+		return nil, err
+	}
+	if flags&compositeHaveInstrs != 0 {
+		binary.BigEndian.PutUint16(rewritten[last:], flags&^compositeHaveInstrs)
+	}
+	return rewritten[:end], nil
+}
+
+func buildCmap(mapping map[rune]uint16) []byte {
+	runes := make([]rune, 0, len(mapping))
+	for r := range mapping {
+		runes = append(runes, r)
+	}
+	slices.Sort(runes)
+
+	// Format 4 with one segment per code point, followed by the required
+	// 0xFFFF segment
+	var bmp []rune
+	for _, r := range runes {
+		if r < 0xFFFF {
+			bmp = append(bmp, r)
+		}
+	}
+	segments := len(bmp) + 1
+	format4 := binary.BigEndian.AppendUint16(nil, 4)
+	format4 = binary.BigEndian.AppendUint16(format4, uint16(16+8*segments)) // #nosec G115 -- bounded by the number of glyphs
+	format4 = binary.BigEndian.AppendUint16(format4, 0)
+	format4 = binary.BigEndian.AppendUint16(format4, uint16(2*segments)) // #nosec G115 -- bounded by the number of glyphs
+	searchRange, entrySelector := searchParams(segments, 2)
+	format4 = binary.BigEndian.AppendUint16(format4, searchRange)
+	format4 = binary.BigEndian.AppendUint16(format4, entrySelector)
+	format4 = binary.BigEndian.AppendUint16(format4, uint16(2*segments)-searchRange) // #nosec G115 -- bounded by the number of glyphs
+	for _, r := range bmp {
+		format4 = binary.BigEndian.AppendUint16(format4, uint16(r)) // #nosec G115 -- r is in the basic multilingual plane
+	}
+	format4 = binary.BigEndian.AppendUint16(format4, 0xFFFF)
+	format4 = binary.BigEndian.AppendUint16(format4, 0)
+	for _, r := range bmp {
+		format4 = binary.BigEndian.AppendUint16(format4, uint16(r)) // #nosec G115 -- r is in the basic multilingual plane
+	}
+	format4 = binary.BigEndian.AppendUint16(format4, 0xFFFF)
+	for _, r := range bmp {
+		format4 = binary.BigEndian.AppendUint16(format4, mapping[r]-uint16(r)) // #nosec G115 -- r is in the basic multilingual plane
+	}
+	// Maps 0xFFFF to the .notdef glyph
+	format4 = binary.BigEndian.AppendUint16(format4, 1)
+	for range segments {
+		format4 = binary.BigEndian.AppendUint16(format4, 0)
+	}
+
+	// Format 12 covers code points outside of the basic multilingual plane
+	format12 := binary.BigEndian.AppendUint16(nil, 12)
+	format12 = binary.BigEndian.AppendUint16(format12, 0)
+	format12 = binary.BigEndian.AppendUint32(format12, uint32(16+12*len(runes))) // #nosec G115 -- bounded by the number of glyphs
+	format12 = binary.BigEndian.AppendUint32(format12, 0)
+	format12 = binary.BigEndian.AppendUint32(format12, uint32(len(runes))) // #nosec G115 -- bounded by the number of glyphs
+	for _, r := range runes {
+		format12 = binary.BigEndian.AppendUint32(format12, uint32(r)) // #nosec G115 -- runes are valid code points
+		format12 = binary.BigEndian.AppendUint32(format12, uint32(r)) // #nosec G115 -- runes are valid code points
+		format12 = binary.BigEndian.AppendUint32(format12, uint32(mapping[r]))
+	}
+
+	cmap := binary.BigEndian.AppendUint16(nil, 0)
+	cmap = binary.BigEndian.AppendUint16(cmap, 2)
+	cmap = binary.BigEndian.AppendUint16(cmap, 3)
+	cmap = binary.BigEndian.AppendUint16(cmap, 1)
+	cmap = binary.BigEndian.AppendUint32(cmap, 20)
+	cmap = binary.BigEndian.AppendUint16(cmap, 3)
+	cmap = binary.BigEndian.AppendUint16(cmap, 10)
+	cmap = binary.BigEndian.AppendUint32(cmap, uint32(20+len(format4))) // #nosec G115 -- bounded by the number of glyphs
+	cmap = append(cmap, format4...)
+	return append(cmap, format12...)
+}
+
+// buildName keeps the names identifying the font and the license, which is
+// only kept once as a single-byte Macintosh record to keep subsets small.
+func buildName(name []byte) ([]byte, error) {
+	if len(name) < 6 {
+		return nil, fmt.Errorf("name table is truncated")
+	}
+	count := int(binary.BigEndian.Uint16(name[2:]))
+	storageOffset := int(binary.BigEndian.Uint16(name[4:]))
+	if len(name) < 6+12*count {
+		return nil, fmt.Errorf("name records are truncated")
+	}
+
+	var records, storage []byte
+	kept := 0
+	for index := range count {
+		record := name[6+12*index : 6+12*index+12]
+		platform := binary.BigEndian.Uint16(record)
+		nameID := binary.BigEndian.Uint16(record[6:])
+		if nameID > 6 && (nameID != nameIDLicense || platform != namePlatformMac) {
+			continue
+		}
+
+		length := int(binary.BigEndian.Uint16(record[8:]))
+		offset := storageOffset + int(binary.BigEndian.Uint16(record[10:]))
+		if offset+length > len(name) {
+			return nil, fmt.Errorf("name record %d is out of bounds", index)
+		}
+		records = append(records, record[:10]...)
+		records = binary.BigEndian.AppendUint16(records, uint16(len(storage))) // #nosec G115 -- bounded by the original table
+		storage = append(storage, name[offset:offset+length]...)
+		kept++
+	}
+
+	table := binary.BigEndian.AppendUint16(nil, 0)
+	table = binary.BigEndian.AppendUint16(table, uint16(kept))      // #nosec G115 -- bounded by the original table
+	table = binary.BigEndian.AppendUint16(table, uint16(6+12*kept)) // #nosec G115 -- bounded by the original table
+	table = append(table, records...)
+	return append(table, storage...), nil
+}
+
+func searchParams(count int, size int) (uint16, uint16) {
+	var entrySelector uint16
+	for 1<<(entrySelector+1) <= count {
+		entrySelector++
+	}
+	return uint16(size << entrySelector), entrySelector // #nosec G115 -- bounded by the number of tables or glyphs
+}
+
+func checksum(data []byte) uint32 {
+	var sum uint32
+	for offset := 0; offset < len(data); offset += 4 {
+		var word [4]byte
+		copy(word[:], data[offset:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+func assembleFont(tables fontTables) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	searchRange, entrySelector := searchParams(len(tags), 16)
+	header := binary.BigEndian.AppendUint32(nil, 0x00010000)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(tags))) // #nosec G115 -- a handful of tables
+	header = binary.BigEndian.AppendUint16(header, searchRange)
+	header = binary.BigEndian.AppendUint16(header, entrySelector)
+	header = binary.BigEndian.AppendUint16(header, uint16(16*len(tags))-searchRange) // #nosec G115 -- a handful of tables
+
+	var body bytes.Buffer
+	offset := len(header) + 16*len(tags)
+	var headOffset int
+	for _, tag := range tags {
+		table := tables[tag]
+		if tag == "head" {
+			headOffset = offset + body.Len()
+		}
+		header = append(header, tag...)
+		header = binary.BigEndian.AppendUint32(header, checksum(table))
+		header = binary.BigEndian.AppendUint32(header, uint32(offset+body.Len())) // #nosec G115 -- subsets are small
+		header = binary.BigEndian.AppendUint32(header, uint32(len(table)))        // #nosec G115 -- subsets are small
+		body.Write(table)
+		body.Write(make([]byte, (4-len(table)%4)%4))
+	}
+
+	font := append(header, body.Bytes()...)
+	binary.BigEndian.PutUint32(font[headOffset+8:], 0xB1B0AFBA-checksum(font))
+	return font
+}
+
+// Subset returns a TrueType font with only the glyphs needed to draw text.
+// Glyphs are renumbered and hinting is dropped.
+func (f *Font) Subset(text string) ([]byte, error) {
+	tables, err := parseTables(f.data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font: %w", err)
+	}
+	offsets, err := tables.glyphOffsets()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font: %w", err)
+	}
+	glyphs, err := tables.glyphClosure(offsets, f.Glyphs(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve composite glyphs: %w", err)
+	}
+
+	remap := make(map[sfnt.GlyphIndex]uint16, len(glyphs))
+	for newIndex, index := range glyphs {
+		remap[index] = uint16(newIndex) // #nosec G115 -- glyph indices fit in 16 bits
+	}
+
+	var glyf, loca, hmtx []byte
+	numHMetrics := int(binary.BigEndian.Uint16(tables["hhea"][34:]))
+	for _, index := range glyphs {
+		glyph, err := tables.glyph(offsets, index)
+		if err != nil {
+			return nil, err
+		}
+		rewritten, err := rewriteGlyph(glyph, remap)
+		if err != nil {
+			return nil, fmt.Errorf("failed to rewrite glyph %d: %w", index, err)
+		}
+		loca = binary.BigEndian.AppendUint32(loca, uint32(len(glyf))) // #nosec G115 -- subsets are small
+		glyf = append(glyf, rewritten...)
+		glyf = append(glyf, make([]byte, (4-len(glyf)%4)%4)...)
+
+		metric := min(int(index), numHMetrics-1)
+		lsbOffset := 4*metric + 2
+		if int(index) >= numHMetrics {
+			lsbOffset = 4*numHMetrics + 2*(int(index)-numHMetrics)
+		}
+		if len(tables["hmtx"]) < max(4*metric+2, lsbOffset+2) {
+			return nil, fmt.Errorf("hmtx table is truncated")
+		}
+		hmtx = append(hmtx, tables["hmtx"][4*metric:4*metric+2]...)
+		hmtx = append(hmtx, tables["hmtx"][lsbOffset:lsbOffset+2]...)
+	}
+	loca = binary.BigEndian.AppendUint32(loca, uint32(len(glyf))) // #nosec G115 -- subsets are small
+
+	var buf sfnt.Buffer
+	mapping := make(map[rune]uint16)
+	for _, r := range text {
+		if index, err := f.font.GlyphIndex(&buf, r); err == nil && index != 0 {
+			mapping[r] = remap[index]
+		}
+	}
+
+	name, err := buildName(tables["name"])
+	if err != nil {
+		return nil, fmt.Errorf("failed to subset name table: %w", err)
+	}
+
+	head := slices.Clone(tables["head"])
+	binary.BigEndian.PutUint32(head[8:], 0)
+	binary.BigEndian.PutUint16(head[50:], 1)
+	hhea := slices.Clone(tables["hhea"])
+	binary.BigEndian.PutUint16(hhea[34:], uint16(len(glyphs))) // #nosec G115 -- glyph counts fit in 16 bits
+	maxp := slices.Clone(tables["maxp"])
+	binary.BigEndian.PutUint16(maxp[4:], uint16(len(glyphs))) // #nosec G115 -- glyph counts fit in 16 bits
+	post := slices.Clone(tables["post"][:32])
+	binary.BigEndian.PutUint32(post, 0x00030000)
+
+	subset := fontTables{
+		"cmap": buildCmap(mapping),
+		"glyf": glyf,
+		"head": head,
+		"hhea": hhea,
+		"hmtx": hmtx,
+		"loca": loca,
+		"maxp": maxp,
+		"name": name,
+		"post": post,
+	}
+	if os2, exists := tables["OS/2"]; exists {
+		subset["OS/2"] = os2
+	}
+	return assembleFont(subset), nil
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+func TestSubset(t *testing.T) {
+	const text = "Maëlys Ŀ Χαράλαμπος Ǆ fi 12,5 %"
+
+	for _, f := range []*Font{SansFont, SansMediumFont, SansBoldFont, MonoFont} {
+		t.Run(f.name, func(t *testing.T) {
+			data, err := f.Subset(text)
+			if err != nil {
+				t.Fatalf("Failed to subset font: %v", err)
+			}
+			if len(data) > len(f.data)/4 {
+				t.Fatalf("Expected a small subset, got %d bytes out of %d", len(data), len(f.data))
+			}
+
+			subset, err := sfnt.Parse(data)
+			if err != nil {
+				t.Fatalf("Failed to parse subset: %v", err)
+			}
+			if subset.NumGlyphs() >= f.font.NumGlyphs() {
+				t.Fatalf("Expected glyphs to be dropped, got %d glyphs", subset.NumGlyphs())
+			}
+
+			var buf, subsetBuf sfnt.Buffer
+			ppem := fixed.I(16)
+			for _, r := range text {
+				original, _ := f.font.GlyphIndex(&buf, r)
+				index, err := subset.GlyphIndex(&subsetBuf, r)
+				if err != nil || (index == 0) != (original == 0) {
+					t.Fatalf("Expected %q to be mapped like the original font, got glyph %d: %v", r, index, err)
+				}
+				if index == 0 {
+					continue
+				}
+
+				advance, _ := f.font.GlyphAdvance(&buf, original, ppem, font.HintingNone)
+				subsetAdvance, err := subset.GlyphAdvance(&subsetBuf, index, ppem, font.HintingNone)
+				if err != nil || advance != subsetAdvance {
+					t.Fatalf("Expected %q to advance by %v, got %v: %v", r, advance, subsetAdvance, err)
+				}
+
+				segments, _ := f.font.LoadGlyph(&buf, original, ppem, nil)
+				subsetSegments, err := subset.LoadGlyph(&subsetBuf, index, ppem, nil)
+				if err != nil || len(segments) != len(subsetSegments) {
+					t.Fatalf("Expected %q to keep its outline, got %d segments out of %d: %v", r, len(subsetSegments), len(segments), err)
+				}
+			}
+		})
+	}
+}
+
+func TestEmbedFonts(t *testing.T) {
+	svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg"><title>Level 12</title>` +
+		`<text font-family="ftbadge, sans-serif" font-weight="800">Tom &amp; Jerry</text>` +
+		`<text font-family="ftbadge, sans-serif" font-weight="600">42cursus<tspan font-weight="400"> | student</tspan></text>` +
+		`<text font-family="serif">Ignored</text></svg>`)
+
+	embedded, err := EmbedFonts(svg)
+	if err != nil {
+		t.Fatalf("Failed to embed fonts: %v", err)
+	}
+	if !bytes.HasSuffix(embedded, svg[bytes.IndexByte(svg, '>')+1:]) {
+		t.Fatalf("Expected the style to be inserted after the svg element, got %s", embedded)
+	}
+
+	faces := regexp.MustCompile(`font-weight:([0-9 ]+);src:url\(data:font/ttf;base64,([^)]+)\)`).FindAllSubmatch(embedded, -1)
+	expected := map[string]string{"1 450": "| student", "451 650": "42cursus", "651 1000": "Tom & Jerry"}
+	if len(faces) != len(expected) {
+		t.Fatalf("Expected %d font faces, got %d", len(expected), len(faces))
+	}
+	for _, face := range faces {
+		data, err := base64.StdEncoding.DecodeString(string(face[2]))
+		if err != nil {
+			t.Fatalf("Failed to decode font face: %v", err)
+		}
+		subset, err := sfnt.Parse(data)
+		if err != nil {
+			t.Fatalf("Failed to parse font face: %v", err)
+		}
+
+		var buf sfnt.Buffer
+		for _, r := range strings.ReplaceAll(expected[string(face[1])], " ", "") {
+			if index, err := subset.GlyphIndex(&buf, r); err != nil || index == 0 {
+				t.Fatalf("Expected the %s face to include %q", face[1], r)
+			}
+		}
+		if index, _ := subset.GlyphIndex(&buf, 'I'); index != 0 {
+			t.Fatalf("Expected the %s face to skip text drawn with other fonts", face[1])
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomedium"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/text/width"
+)
+
+const (
+	FontSans       = "sans"
+	FontSansMedium = "sans-medium"
+	FontSansBold   = "sans-bold"
+	FontMono       = "mono"
+)
+
+const ellipsis = "…"
+
+// Font measures text with the advance widths of an embedded font. Glyphs
+// missing from the font, such as CJK characters, are estimated from their East
+// Asian width.
+type Font struct {
+	name       string
+	data       []byte
+	font       *sfnt.Font
+	unitsPerEm fixed.Int26_6
+}
+
+var (
+	SansFont       = mustParseFont(FontSans, goregular.TTF)
+	SansMediumFont = mustParseFont(FontSansMedium, gomedium.TTF)
+	SansBoldFont   = mustParseFont(FontSansBold, gobold.TTF)
+	MonoFont       = mustParseFont(FontMono, gomono.TTF)
+)
+
+var fonts = map[string]*Font{
+	FontSans:       SansFont,
+	FontSansMedium: SansMediumFont,
+	FontSansBold:   SansBoldFont,
+	FontMono:       MonoFont,
+}
+
+func mustParseFont(name string, data []byte) *Font {
+	parsed, err := sfnt.Parse(data)
+	if err != nil {
+		panic(fmt.Sprintf("failed to parse embedded font %q: %v", name, err))
+	}
+	return &Font{name: name, data: data, font: parsed, unitsPerEm: fixed.I(int(parsed.UnitsPerEm()))}
+}
+
+func GetFont(name string) (*Font, error) {
+	f, exists := fonts[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown font %q", name)
+	}
+	return f, nil
+}
+
+// advance returns the width of r in ems.
+func (f *Font) advance(buf *sfnt.Buffer, r rune) float64 {
+	if unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r) {
+		return 0
+	}
+
+	index, err := f.font.GlyphIndex(buf, r)
+	if err == nil && index != 0 {
+		advance, err := f.font.GlyphAdvance(buf, index, f.unitsPerEm, font.HintingNone)
+		if err == nil {
+			return float64(advance) / float64(f.unitsPerEm)
+		}
+	}
+
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 1
+	default:
+		return 0.6
+	}
+}
+
+// Measure returns the width of text in pixels. Letter spacing is added after
+// every character like SVG renderers do.
+func (f *Font) Measure(text string, size float64, letterSpacing float64) float64 {
+	var buf sfnt.Buffer
+	var ems float64
+	var count int
+	for _, r := range text {
+		ems += f.advance(&buf, r)
+		count++
+	}
+	return ems*size + letterSpacing*float64(count)
+}
+
+// Ellipsize shortens text with an ellipsis until it fits in maxWidth.
+func (f *Font) Ellipsize(text string, size float64, letterSpacing float64, maxWidth float64) string {
+	if f.Measure(text, size, letterSpacing) <= maxWidth {
+		return text
+	}
+
+	runes := []rune(text)
+	for length := len(runes) - 1; length > 0; length-- {
+		truncated := strings.TrimRightFunc(string(runes[:length]), unicode.IsSpace) + ellipsis
+		if f.Measure(truncated, size, letterSpacing) <= maxWidth {
+			return truncated
+		}
+	}
+	return ellipsis
+}
+
+// FitSize returns the largest font size, down to minSize in steps of half a
+// pixel, at which text fits in maxWidth.
+func (f *Font) FitSize(text string, size float64, minSize float64, letterSpacing float64, maxWidth float64) float64 {
+	ems := f.Measure(text, 1, 0)
+	if ems == 0 {
+		return size
+	}
+	spacing := f.Measure(text, 0, letterSpacing)
+	fitted := math.Floor((maxWidth-spacing)/ems*2) / 2
+	return max(min(fitted, size), minSize)
+}
+
+// TextFuncs are the template functions used to fit text in a badge. The font
+// is given by name, for example {{ Ellipsize .Name "sans-bold" 18 0.5 196 }}.
+var TextFuncs = template.FuncMap{
+	"MeasureText": func(text string, name string, size float64, letterSpacing float64) (float64, error) {
+		f, err := GetFont(name)
+		if err != nil {
+			return 0, err
+		}
+		return f.Measure(text, size, letterSpacing), nil
+	},
+	"Ellipsize": func(text string, name string, size float64, letterSpacing float64, maxWidth float64) (string, error) {
+		f, err := GetFont(name)
+		if err != nil {
+			return "", err
+		}
+		return f.Ellipsize(text, size, letterSpacing, maxWidth), nil
+	},
+	"FitFontSize": func(text string, name string, size float64, minSize float64, letterSpacing float64, maxWidth float64) (float64, error) {
+		f, err := GetFont(name)
+		if err != nil {
+			return 0, err
+		}
+		return f.FitSize(text, size, minSize, letterSpacing, maxWidth), nil
+	},
+}
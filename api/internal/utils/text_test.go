@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestFitText(t *testing.T) {
+	names := []string{
+		"Test User",
+		"Jean-Baptiste Emmanuel Zorg de la Tour d'Auvergne",
+		"Maëlys Lefèvre-Châtelain",
+		"Александр Владимирович Константинопольский",
+		"Χαράλαμπος Παπαδόπουλος",
+		"山田 太郎",
+		"ウィリアム・シェイクスピア・ジュニア・フォン・ミュンヒハウゼン",
+		"김민준 이서연 박지후 최하은",
+		"محمد بن عبد الله الهاشمي القرشي",
+		"Zoë Nguyễn",
+	}
+
+	var golden strings.Builder
+	for _, name := range names {
+		size := SansBoldFont.FitSize(name, 18, 13, .5, 196)
+		fmt.Fprintf(&golden, "%s\n\twidth: %.2f\n\tsize: %g\n\tellipsized: %s\n",
+			name,
+			SansBoldFont.Measure(name, 18, .5),
+			size,
+			SansBoldFont.Ellipsize(name, size, .5, 196),
+		)
+	}
+
+	path := filepath.Join("testdata", "fit_text.golden")
+	if *update {
+		if err := os.WriteFile(path, []byte(golden.String()), 0o600); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+	}
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read golden file: %v", err)
+	}
+	if golden.String() != string(expected) {
+		t.Fatalf("Fitted text does not match %s, run with -update to review the changes:\n%s", path, golden.String())
+	}
+}
+
+func TestEllipsize(t *testing.T) {
+	for _, maxWidth := range []float64{0, 20, 50, 100, 196} {
+		for _, text := range []string{"Jean-Baptiste Emmanuel Zorg", "ウィリアム・シェイクスピア"} {
+			ellipsized := MonoFont.Ellipsize(text, 9, .5, maxWidth)
+			if width := MonoFont.Measure(ellipsized, 9, .5); width > maxWidth && ellipsized != ellipsis {
+				t.Fatalf("Expected %q to fit in %g, got width %g", ellipsized, maxWidth, width)
+			}
+		}
+	}
+
+	if _, err := GetFont("serif"); err == nil {
+		t.Fatal("Expected an unknown font to be rejected")
+	}
+}
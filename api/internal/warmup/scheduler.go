@@ -0,0 +1,130 @@
+package warmup
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/time/rate"
+)
+
+// RenderFunc returns when the cached profile was written, or the zero time
+// when nothing was cached, for example because another instance renders it.
+type RenderFunc func(ctx context.Context, login string) (time.Time, error)
+
+type SchedulerConfig struct {
+	// Logins rendered once on startup in addition to the saved top logins
+	Logins    []string
+	StatsPath string
+	TopN      int
+	// How often the scheduler looks for profiles close to expiry
+	Interval time.Duration
+	// Profiles are refreshed this long before their cache entry expires
+	Margin time.Duration
+	TTL    time.Duration
+	// Maximum number of Intra requests per second spent on refreshes
+	Rate rate.Limit
+
+	Warm    RenderFunc
+	Refresh RenderFunc
+	Logger  zerolog.Logger
+}
+
+type Scheduler struct {
+	config  SchedulerConfig
+	tracker *Tracker
+	limiter *rate.Limiter
+}
+
+// TrackedLoginsPerTopLogin sizes the tracker, so that logins outside the top
+// ones can collect hits before they make it in.
+const TrackedLoginsPerTopLogin = 10
+
+func NewScheduler(config SchedulerConfig, tracker *Tracker) *Scheduler {
+	limiter := rate.NewLimiter(config.Rate, 1)
+	return &Scheduler{config, tracker, limiter}
+}
+
+func (s *Scheduler) Run(ctx context.Context) {
+	if s.config.StatsPath != "" {
+		if err := s.tracker.Load(s.config.StatsPath); err != nil {
+			s.config.Logger.Error().Err(err).Msg("failed to load hit statistics")
+		}
+		defer s.saveStats()
+	}
+
+	s.warm(ctx)
+
+	if s.config.TopN <= 0 || s.config.Interval <= 0 {
+		<-ctx.Done()
+		return
+	}
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.refreshDue(ctx)
+			s.tracker.Prune(s.config.TopN * TrackedLoginsPerTopLogin)
+			if s.config.StatsPath != "" {
+				s.saveStats()
+			}
+		}
+	}
+}
+
+func (s *Scheduler) warm(ctx context.Context) {
+	seen := make(map[string]struct{})
+	logins := slices.Concat(s.config.Logins, s.tracker.Top(s.config.TopN))
+
+	for _, login := range logins {
+		if _, exists := seen[login]; exists {
+			continue
+		}
+		seen[login] = struct{}{}
+
+		if err := s.limiter.Wait(ctx); err != nil {
+			return
+		}
+		cachedAt, err := s.config.Warm(ctx, login)
+		if err != nil {
+			s.config.Logger.Warn().Err(err).Str("login", login).Msg("failed to warm profile")
+			continue
+		}
+		if !cachedAt.IsZero() {
+			s.tracker.MarkRefreshed(login, cachedAt)
+		}
+	}
+}
+
+func (s *Scheduler) refreshDue(ctx context.Context) {
+	for _, login := range s.tracker.Top(s.config.TopN) {
+		refreshedAt, known := s.tracker.RefreshedAt(login)
+		if known && time.Since(refreshedAt) < s.config.TTL-s.config.Margin {
+			continue
+		}
+
+		if err := s.limiter.Wait(ctx); err != nil {
+			return
+		}
+		cachedAt, err := s.config.Refresh(ctx, login)
+		if err != nil {
+			s.config.Logger.Warn().Err(err).Str("login", login).Msg("failed to refresh profile")
+			continue
+		}
+		if !cachedAt.IsZero() {
+			s.tracker.MarkRefreshed(login, cachedAt)
+		}
+	}
+}
+
+func (s *Scheduler) saveStats() {
+	if err := s.tracker.Save(s.config.StatsPath); err != nil {
+		s.config.Logger.Error().Err(err).Msg("failed to save hit statistics")
+	}
+}
@@ -0,0 +1,122 @@
+package warmup
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/time/rate"
+)
+
+type renderRecorder struct {
+	logins []string
+	failed map[string]bool
+	// Logins rendered by another instance, for which nothing is cached
+	skipped map[string]bool
+}
+
+func (r *renderRecorder) render(ctx context.Context, login string) (time.Time, error) {
+	r.logins = append(r.logins, login)
+	if r.failed[login] {
+		return time.Time{}, errors.New("render failed")
+	}
+	if r.skipped[login] {
+		return time.Time{}, nil
+	}
+	return time.Now(), nil
+}
+
+func newTestScheduler(tracker *Tracker, logins []string, warm *renderRecorder, refresh *renderRecorder) *Scheduler {
+	return NewScheduler(SchedulerConfig{
+		Logins:   logins,
+		TopN:     3,
+		Interval: time.Minute,
+		Margin:   time.Hour,
+		TTL:      24 * time.Hour,
+		Rate:     rate.Inf,
+		Warm:     warm.render,
+		Refresh:  refresh.render,
+		Logger:   zerolog.Nop(),
+	}, tracker)
+}
+
+func TestSchedulerRefreshDue(t *testing.T) {
+	tracker := NewTracker(30)
+	recordHits(tracker, map[string]int{"alice": 5, "bob": 4, "carol": 3, "dave": 2})
+
+	now := time.Now()
+	tracker.MarkRefreshed("alice", now.Add(-23*time.Hour-30*time.Minute))
+	tracker.MarkRefreshed("bob", now.Add(-time.Hour))
+	tracker.MarkRefreshed("carol", time.Time{})
+
+	refresh := &renderRecorder{}
+	scheduler := newTestScheduler(tracker, nil, &renderRecorder{}, refresh)
+	scheduler.refreshDue(t.Context())
+
+	// alice is within the margin and carol was never refreshed, bob is fresh
+	// and dave is not in the top logins
+	if !slices.Equal(refresh.logins, []string{"alice", "carol"}) {
+		t.Fatalf("Expected alice and carol to be refreshed, got %q", refresh.logins)
+	}
+	if refreshedAt, known := tracker.RefreshedAt("carol"); !known || refreshedAt.Before(now) {
+		t.Fatalf("Expected carol to be marked refreshed, got %v", refreshedAt)
+	}
+
+	refresh.logins = nil
+	scheduler.refreshDue(t.Context())
+	if len(refresh.logins) != 0 {
+		t.Fatalf("Expected refreshed logins to wait for the next expiry, got %q", refresh.logins)
+	}
+}
+
+func TestSchedulerRefreshFailure(t *testing.T) {
+	tracker := NewTracker(30)
+	recordHits(tracker, map[string]int{"alice": 1})
+	tracker.MarkRefreshed("alice", time.Now().Add(-24*time.Hour))
+
+	refresh := &renderRecorder{failed: map[string]bool{"alice": true}}
+	scheduler := newTestScheduler(tracker, nil, &renderRecorder{}, refresh)
+	scheduler.refreshDue(t.Context())
+	scheduler.refreshDue(t.Context())
+
+	if !slices.Equal(refresh.logins, []string{"alice", "alice"}) {
+		t.Fatalf("Expected a failed refresh to be retried, got %q", refresh.logins)
+	}
+}
+
+func TestSchedulerWarm(t *testing.T) {
+	tracker := NewTracker(30)
+	recordHits(tracker, map[string]int{"alice": 2, "bob": 1})
+
+	warm := &renderRecorder{failed: map[string]bool{"erin": true}}
+	scheduler := newTestScheduler(tracker, []string{"bob", "erin"}, warm, &renderRecorder{})
+	scheduler.warm(t.Context())
+
+	if !slices.Equal(warm.logins, []string{"bob", "erin", "alice"}) {
+		t.Fatalf("Expected configured then top logins without duplicates, got %q", warm.logins)
+	}
+	if _, known := tracker.RefreshedAt("erin"); known {
+		t.Fatal("Expected a failed warm-up not to be marked refreshed")
+	}
+	if _, known := tracker.RefreshedAt("bob"); !known {
+		t.Fatal("Expected a warmed login to be marked refreshed")
+	}
+}
+
+func TestSchedulerRefreshByOtherInstance(t *testing.T) {
+	tracker := NewTracker(30)
+	recordHits(tracker, map[string]int{"alice": 1})
+	refreshedAt := time.Now().Add(-24 * time.Hour)
+	tracker.MarkRefreshed("alice", refreshedAt)
+
+	refresh := &renderRecorder{skipped: map[string]bool{"alice": true}}
+	scheduler := newTestScheduler(tracker, nil, &renderRecorder{}, refresh)
+	scheduler.refreshDue(t.Context())
+
+	if marked, _ := tracker.RefreshedAt("alice"); !marked.Equal(refreshedAt) {
+		t.Fatalf("Expected a refresh left to another instance not to be marked, got %v", marked)
+	}
+}
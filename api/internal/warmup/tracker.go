@@ -0,0 +1,168 @@
+package warmup
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+type loginStats struct {
+	hits        uint64
+	refreshedAt time.Time
+}
+
+// Tracker counts hits of rendered profiles. It keeps at most maxLogins logins,
+// dropping the least requested half once full, so that requests for many
+// different logins cannot grow it without bound.
+type Tracker struct {
+	mu        sync.Mutex
+	stats     map[string]*loginStats
+	maxLogins int
+}
+
+// NewTracker returns a tracker keeping up to maxLogins logins. Nothing is
+// recorded when maxLogins is zero.
+func NewTracker(maxLogins int) *Tracker {
+	return &Tracker{stats: make(map[string]*loginStats), maxLogins: maxLogins}
+}
+
+// Record counts a hit of login, whose profile was cached at cachedAt. The
+// cache entry may have been written by another instance or before a restart,
+// so only a later write moves the refresh time forward.
+func (t *Tracker) Record(login string, cachedAt time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats, exists := t.stats[login]
+	if !exists {
+		if t.maxLogins <= 0 {
+			return
+		}
+		if len(t.stats) >= t.maxLogins {
+			t.prune(t.maxLogins / 2)
+		}
+		stats = &loginStats{}
+		t.stats[login] = stats
+	}
+	stats.hits++
+	if cachedAt.After(stats.refreshedAt) {
+		stats.refreshedAt = cachedAt
+	}
+}
+
+func (t *Tracker) MarkRefreshed(login string, refreshedAt time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats, exists := t.stats[login]
+	if !exists {
+		stats = &loginStats{}
+		t.stats[login] = stats
+	}
+	stats.refreshedAt = refreshedAt
+}
+
+func (t *Tracker) RefreshedAt(login string) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats, exists := t.stats[login]
+	if !exists || stats.refreshedAt.IsZero() {
+		return time.Time{}, false
+	}
+	return stats.refreshedAt, true
+}
+
+func (t *Tracker) sortedLogins() []string {
+	logins := make([]string, 0, len(t.stats))
+	for login := range t.stats {
+		logins = append(logins, login)
+	}
+	slices.SortFunc(logins, func(a, b string) int {
+		if c := cmp.Compare(t.stats[b].hits, t.stats[a].hits); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	})
+	return logins
+}
+
+func (t *Tracker) Top(n int) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	logins := t.sortedLogins()
+	return logins[:min(n, len(logins))]
+}
+
+func (t *Tracker) Prune(keep int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune(keep)
+}
+
+func (t *Tracker) prune(keep int) {
+	logins := t.sortedLogins()
+	for _, login := range logins[min(max(keep, 0), len(logins)):] {
+		delete(t.stats, login)
+	}
+}
+
+func (t *Tracker) Save(path string) error {
+	t.mu.Lock()
+	hits := make(map[string]uint64, len(t.stats))
+	for login, stats := range t.stats {
+		hits[login] = stats.hits
+	}
+	t.mu.Unlock()
+
+	data, err := json.Marshal(hits)
+	if err != nil {
+		return fmt.Errorf("failed to marshal hit statistics: %w", err)
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write hit statistics to %q: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace hit statistics file %q: %w", path, err)
+	}
+	return nil
+}
+
+// Load merges previously saved hit counts into the tracker. A missing file is
+// not an error since it is expected on the first start.
+func (t *Tracker) Load(path string) error {
+	data, err := os.ReadFile(path) // #nosec G304 -- path comes from configuration
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read hit statistics from %q: %w", path, err)
+	}
+
+	var hits map[string]uint64
+	if err := json.Unmarshal(data, &hits); err != nil {
+		return fmt.Errorf("failed to unmarshal hit statistics from %q: %w", path, err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for login, count := range hits {
+		stats, exists := t.stats[login]
+		if !exists {
+			stats = &loginStats{}
+			t.stats[login] = stats
+		}
+		stats.hits += count
+	}
+	t.prune(t.maxLogins)
+	return nil
+}
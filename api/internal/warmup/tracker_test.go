@@ -0,0 +1,126 @@
+package warmup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func recordHits(tracker *Tracker, hits map[string]int) {
+	for login, count := range hits {
+		for range count {
+			tracker.Record(login, time.Time{})
+		}
+	}
+}
+
+func TestTrackerTopAndPrune(t *testing.T) {
+	tracker := NewTracker(10)
+	recordHits(tracker, map[string]int{"alice": 3, "bob": 5, "carol": 3, "dave": 1})
+
+	if top := tracker.Top(3); !slices.Equal(top, []string{"bob", "alice", "carol"}) {
+		t.Fatalf("Expected logins by hits then name, got %q", top)
+	}
+	if top := tracker.Top(10); len(top) != 4 {
+		t.Fatalf("Expected every login when n exceeds the tracked logins, got %q", top)
+	}
+
+	tracker.Prune(2)
+	if top := tracker.Top(10); !slices.Equal(top, []string{"bob", "alice"}) {
+		t.Fatalf("Expected only the two top logins to be kept, got %q", top)
+	}
+	if _, known := tracker.RefreshedAt("carol"); known {
+		t.Fatal("Expected pruned logins to be forgotten")
+	}
+}
+
+func TestTrackerCap(t *testing.T) {
+	tracker := NewTracker(100)
+	recordHits(tracker, map[string]int{"popular": 10})
+	for index := range 10_000 {
+		tracker.Record(fmt.Sprintf("login%d", index), time.Time{})
+	}
+
+	if size := len(tracker.Top(1_000_000)); size > 100 {
+		t.Fatalf("Expected at most 100 tracked logins, got %d", size)
+	}
+	if top := tracker.Top(1); !slices.Equal(top, []string{"popular"}) {
+		t.Fatalf("Expected the popular login to survive pruning, got %q", top)
+	}
+
+	disabled := NewTracker(0)
+	disabled.Record("alice", time.Now())
+	if top := disabled.Top(10); len(top) != 0 {
+		t.Fatalf("Expected a disabled tracker to record nothing, got %q", top)
+	}
+}
+
+func TestTrackerSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	tracker := NewTracker(10)
+	recordHits(tracker, map[string]int{"alice": 2, "bob": 3})
+	if err := tracker.Save(path); err != nil {
+		t.Fatalf("Failed to save hit statistics: %v", err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("Expected the temporary file to be renamed, got %v", err)
+	}
+
+	loaded := NewTracker(10)
+	recordHits(loaded, map[string]int{"alice": 2})
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Failed to load hit statistics: %v", err)
+	}
+	// Saved hits are added to the ones recorded since startup
+	if top := loaded.Top(2); !slices.Equal(top, []string{"alice", "bob"}) {
+		t.Fatalf("Expected merged hit counts, got %q", top)
+	}
+
+	if err := NewTracker(10).Load(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Fatalf("Expected a missing file to be ignored, got %v", err)
+	}
+	if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatalf("Failed to write corrupted statistics: %v", err)
+	}
+	if err := NewTracker(10).Load(path); err == nil {
+		t.Fatal("Expected corrupted statistics to be rejected")
+	}
+
+	small := NewTracker(1)
+	if err := small.Load(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Fatalf("Failed to load missing statistics: %v", err)
+	}
+	if err := tracker.Save(path); err != nil {
+		t.Fatalf("Failed to save hit statistics: %v", err)
+	}
+	if err := small.Load(path); err != nil {
+		t.Fatalf("Failed to load hit statistics: %v", err)
+	}
+	if top := small.Top(10); !slices.Equal(top, []string{"bob"}) {
+		t.Fatalf("Expected loaded logins to be capped, got %q", top)
+	}
+}
+
+func TestTrackerRecordCachedAt(t *testing.T) {
+	tracker := NewTracker(10)
+	tracker.Record("alice", time.Time{})
+	if _, known := tracker.RefreshedAt("alice"); known {
+		t.Fatal("Expected a login without cache time not to be marked refreshed")
+	}
+
+	cachedAt := time.Now().Add(-20 * time.Hour)
+	tracker.Record("alice", cachedAt)
+	tracker.Record("alice", cachedAt.Add(-time.Hour))
+	if refreshedAt, known := tracker.RefreshedAt("alice"); !known || !refreshedAt.Equal(cachedAt) {
+		t.Fatalf("Expected the refresh time to be the cache time %v, got %v", cachedAt, refreshedAt)
+	}
+
+	rewrittenAt := cachedAt.Add(time.Hour)
+	tracker.Record("alice", rewrittenAt)
+	if refreshedAt, _ := tracker.RefreshedAt("alice"); !refreshedAt.Equal(rewrittenAt) {
+		t.Fatalf("Expected a later write to move the refresh time to %v, got %v", rewrittenAt, refreshedAt)
+	}
+}